@@ -0,0 +1,926 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/wadlib"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// command represents a single subcommand available to the user.
+type command struct {
+	// Name is what the user types to invoke this command.
+	Name string
+
+	// Description is a short, one-line summary shown within usage.
+	Description string
+
+	// Run is invoked with all arguments following the command's name.
+	// Any error returned is printed, and determines our exit code.
+	Run func(args []string) error
+}
+
+// commands contains all subcommands available.
+// It is populated within init to permit usage to reference it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			Name:        "patch",
+			Description: "Download, patch, and write a patched Wii Shop Channel WAD",
+			Run:         runPatch,
+		},
+		{
+			Name:        "download",
+			Description: "Download and cache the original Wii Shop Channel",
+			Run:         runDownload,
+		},
+		{
+			Name:        "certs",
+			Description: "Generate a root CA and server certificate for a base domain",
+			Run:         runCerts,
+		},
+		{
+			Name:        "inspect",
+			Description: "Print information about a WAD and its contents",
+			Run:         runInspect,
+		},
+		{
+			Name:        "patches",
+			Description: "List all patch sets and patches available to select",
+			Run:         runPatches,
+		},
+		{
+			Name:        "verify",
+			Description: "Verify all DOL patches can be applied to the cached WAD",
+			Run:         runVerify,
+		},
+		{
+			Name:        "unpatch",
+			Description: "Restore the original Wii Shop Channel from a patched WAD",
+			Run:         runUnpatch,
+		},
+		{
+			Name:        "apply",
+			Description: "Reconstruct a patched WAD from your original WAD and a delta",
+			Run:         runApply,
+		},
+		{
+			Name:        "status",
+			Description: "Report which patches a WAD contains, and what it was patched with",
+			Run:         runStatus,
+		},
+	}
+}
+
+// findCommand returns the command with the given name, or nil if none exist.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+// printUsage prints all available commands.
+func printUsage() {
+	fmt.Printf("Usage: %s <command> [flags]\n", os.Args[0])
+	fmt.Println()
+	fmt.Println("Available commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Println()
+	fmt.Printf("Run \"%s <command> -h\" for a command's flags.\n", os.Args[0])
+	fmt.Println("For more information, please refer to the README.")
+}
+
+// newFlagSet returns a flag set for the given command, with usage
+// describing the command prior to its flags.
+func newFlagSet(name string, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s %s [flags]\n", os.Args[0], name)
+		fmt.Println(description)
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// stringList is a flag accepting comma-separated values.
+// It may be passed multiple times, accumulating all values.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, strings.Split(value, ",")...)
+	return nil
+}
+
+// addSelectionFlags registers flags selecting patch sets and patches,
+// returning a function to apply them to the given profile once parsed.
+func addSelectionFlags(flags *flag.FlagSet) func(profile *Profile) error {
+	var patchSets, disabled, patchFiles stringList
+	flags.Var(&patchSets, "patch-sets", "comma-separated identifiers of patch sets to apply, in order (see \"patches\")")
+	flags.Var(&disabled, "disable-patch", "name of an individual patch to skip; may be passed multiple times")
+	flags.Var(&patchFiles, "patch-file", "path to a YAML or JSON file defining an additional patch set; may be passed multiple times")
+
+	return func(profile *Profile) error {
+		if isFlagPassed(flags, "patch-sets") {
+			profile.PatchSets = patchSets
+		}
+		profile.DisabledPatches = append(profile.DisabledPatches, disabled...)
+		profile.PatchFiles = append(profile.PatchFiles, patchFiles...)
+
+		if err := profile.validate(); err != nil {
+			return &ProfileError{"", err}
+		}
+
+		return nil
+	}
+}
+
+// addUnknownDOLFlag registers a flag permitting main DOLs not known for their revision,
+// returning a function to apply it to the given profile once parsed.
+func addUnknownDOLFlag(flags *flag.FlagSet) func(profile *Profile) {
+	allow := flags.Bool("allow-unknown-dol", false, "permit a main DOL whose hash is not known for its version, such as one already modified")
+
+	return func(profile *Profile) {
+		if isFlagPassed(flags, "allow-unknown-dol") {
+			profile.AllowUnknownDOL = *allow
+		}
+	}
+}
+
+// addVersionFlag registers a flag selecting the version of the Wii Shop Channel,
+// returning a function to apply it to the given profile once parsed.
+func addVersionFlag(flags *flag.FlagSet) func(profile *Profile) error {
+	version := flags.Uint("version", uint(patcher.ShopTitleVersion), "version of the Wii Shop Channel to download and patch")
+
+	return func(profile *Profile) error {
+		if !isFlagPassed(flags, "version") {
+			return nil
+		}
+
+		if *version > 0xffff || patcher.FindVersion(uint16(*version)) == nil {
+			return &UsageError{fmt.Sprintf("version %d of the Wii Shop Channel is not supported", *version)}
+		}
+
+		profile.TitleVersion = uint16(*version)
+		return nil
+	}
+}
+
+// isFlagPassed returns whether the flag with the given name was explicitly passed.
+func isFlagPassed(flags *flag.FlagSet, name string) bool {
+	passed := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+
+	return passed
+}
+
+// printBanner prints our lovely banner.
+func printBanner() {
+	fmt.Println("===========================")
+	fmt.Println("=       WSC-Patcher       =")
+	fmt.Println("===========================")
+}
+
+// addProfileFlags registers flags loading a profile and overriding its paths,
+// returning a function to load it once parsed. Without a profile, our defaults are used.
+// Flags explicitly passed take precedence over the profile.
+func addProfileFlags(flags *flag.FlagSet) func() (Profile, error) {
+	profilePath := flags.String("profile", "", "path to a YAML profile describing this run")
+	workDir := flags.String("work-dir", "", "directory relative paths are resolved against (default \".\")")
+	cacheDir := flags.String("cache-dir", "", "directory the original WAD is cached within (default \"cache\")")
+	outputDir := flags.String("output-dir", "", "directory certificates and the patched WAD are written to (default \"output\")")
+
+	return func() (Profile, error) {
+		profile := defaultProfile()
+		if *profilePath != "" {
+			loaded, err := loadProfile(*profilePath)
+			if err != nil {
+				return Profile{}, err
+			}
+
+			profile = loaded
+		}
+
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "work-dir":
+				profile.Paths.WorkDir = *workDir
+			case "cache-dir":
+				profile.Paths.CacheDir = *cacheDir
+			case "output-dir":
+				profile.Paths.OutputDir = *outputDir
+			}
+		})
+
+		return profile, nil
+	}
+}
+
+func runPatch(args []string) error {
+	flags := newFlagSet("patch", "Applies all patches, writing patched.wad to the output directory unless otherwise specified.")
+	domain := flags.String("domain", "", "base domain to patch in, up to 12 characters")
+	download := flags.Bool("download", false, "download the original WAD even if it is cached")
+	inputWad := flags.String("wad", "", "path to a Wii Shop Channel WAD to patch instead of the cached original, or - for standard input")
+	retarget := flags.Bool("retarget", false, "patch the WAD given via -wad anew, reverting patches from a previous run of WSC-Patcher with another base domain or root certificate")
+	regenerate := flags.Bool("regenerate-certs", false, "issue new certificates even if the root certificate is present")
+	output := flags.String("output", "", "path to write the patched WAD to")
+	dryRunOnly := flags.Bool("dry-run", false, "report where every patch applies without writing anything")
+	reportOutput := flags.String("report", "", "path to write a JSON build report to")
+	deltaOutput := flags.String("delta", "", "path to write a distributable delta from the original to the patched WAD to")
+	symbolMap := flags.String("symbols", "", "path to a symbol map for the main DOL (default: that within the main ARC, if any)")
+	textSectionSize := flags.Uint("text-section-size", 0, "size of a new text section appended to the main DOL for injected code")
+	dataSectionSize := flags.Uint("data-section-size", 0, "size of a new data section appended to the main DOL for injected data, such as larger root certificates")
+	applyProfile := addProfileFlags(flags)
+	applySelection := addSelectionFlags(flags)
+	applyVersion := addVersionFlag(flags)
+	applyUnknownDOL := addUnknownDOLFlag(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if err = applySelection(&profile); err != nil {
+		return err
+	}
+	if err = applyVersion(&profile); err != nil {
+		return err
+	}
+	applyUnknownDOL(&profile)
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "text-section-size":
+			profile.Sections.TextSize = uint32(*textSectionSize)
+		case "data-section-size":
+			profile.Sections.DataSize = uint32(*dataSectionSize)
+		case "domain":
+			profile.BaseDomain = *domain
+		case "regenerate-certs":
+			profile.Certificates.Regenerate = *regenerate
+		case "output":
+			profile.Paths.PatchedWAD = *output
+		case "report":
+			profile.Paths.Report = *reportOutput
+		case "delta":
+			profile.Paths.Delta = *deltaOutput
+		case "wad":
+			profile.Paths.InputWAD = *inputWad
+		case "symbols":
+			profile.Paths.SymbolMap = *symbolMap
+		}
+	})
+
+	if err = validateBaseDomain(profile.BaseDomain); err != nil {
+		return err
+	}
+	if *retarget && (profile.Paths.InputWAD == "" || *dryRunOnly) {
+		return &UsageError{"-retarget requires a previously patched WAD given via -wad, and cannot be combined with -dry-run"}
+	}
+	printBanner()
+
+	originalWad, original, err := loadOriginalWAD(profile, *download)
+	if err != nil {
+		return err
+	}
+	if *dryRunOnly {
+		return runDryRun(profile, originalWad)
+	}
+
+	rootCertificate, err := loadRootCertificate(profile, profile.Certificates.Regenerate)
+	if err != nil {
+		return err
+	}
+
+	return patchWAD(profile, original, rootCertificate, *retarget)
+}
+
+// runDryRun reports where all selected patches apply against the given WAD.
+// Certificates are never issued - if none are present, patches are shown without one.
+func runDryRun(profile Profile, originalWad *wadlib.WAD) error {
+	wadPatcher, err := previewPatcher(profile)
+	if err != nil {
+		return err
+	}
+
+	dol, err := originalWad.GetContent(1)
+	if err != nil {
+		return &CacheCorruptError{profile.inputWADPath(), err}
+	}
+
+	version, err := wadPatcher.Version(originalWad, dol)
+	if err != nil {
+		return err
+	}
+	symbols, err := wadPatcher.Symbols(originalWad)
+	if err != nil {
+		return err
+	}
+	sets, dol, err := wadPatcher.PatchSets(version, dol, symbols)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Title version: %d\n", version.TitleVersion)
+	fmt.Printf("TMD access rights: 0x%x -> 0x%x\n", originalWad.TMD.AccessRightsFlags, wadPatcher.AccessRights(originalWad.TMD.AccessRightsFlags))
+	err = dryRun(sets, dol, symbols)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.Green("All patches can be applied. Nothing was written."))
+	return nil
+}
+
+// previewPatcher returns a patcher for the given profile, utilized to show patches without applying them.
+// Certificates are never issued - if none are present, patches are shown without one.
+func previewPatcher(profile Profile) (*patcher.Patcher, error) {
+	var rootCertificate []byte
+	var err error
+	if filePresent(profile.rootCertificatePath()) {
+		rootCertificate, err = loadRootCertificate(profile, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Println(aurora.Yellow("No root certificate is present; patches are shown without one."))
+	}
+
+	options, err := profile.options(rootCertificate, nil)
+	if err != nil {
+		return nil, err
+	}
+	options.Log = os.Stdout
+
+	return patcher.New(options)
+}
+
+func runDownload(args []string) error {
+	flags := newFlagSet("download", "Downloads the original Wii Shop Channel to the cache directory.")
+	force := flags.Bool("force", false, "download even if a cached copy is present")
+	applyProfile := addProfileFlags(flags)
+	applyVersion := addVersionFlag(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if err = applyVersion(&profile); err != nil {
+		return err
+	}
+
+	if !*force && filePresent(profile.originalWADPath()) {
+		fmt.Println("The original Wii Shop Channel is already cached. Pass -force to download again.")
+		return nil
+	}
+
+	if _, _, err = loadOriginalWAD(profile, true); err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Done! The original WAD is available at %s.", profile.originalWADPath())))
+	return nil
+}
+
+func runCerts(args []string) error {
+	flags := newFlagSet("certs", "Issues a root CA and wildcard server certificate within the output directory.")
+	domain := flags.String("domain", "", "base domain to issue a wildcard certificate for")
+	force := flags.Bool("force", false, "issue new certificates even if the root certificate is present")
+	applyProfile := addProfileFlags(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if isFlagPassed(flags, "domain") {
+		profile.BaseDomain = *domain
+	}
+	if err = validateBaseDomain(profile.BaseDomain); err != nil {
+		return err
+	}
+
+	if !*force && filePresent(profile.rootCertificatePath()) {
+		fmt.Println("A root certificate is already present. Pass -force to issue new certificates.")
+		return nil
+	}
+
+	if _, err = loadRootCertificate(profile, true); err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Done! Certificates are available within %s.", profile.outputPath(""))))
+	return nil
+}
+
+func runInspect(args []string) error {
+	// Disassembly is a distinct mode of inspection, with flags of its own.
+	if len(args) != 0 && args[0] == "disasm" {
+		return runDisasm(args[1:])
+	}
+
+	flags := newFlagSet("inspect", "Prints the title metadata and contents of a WAD, alongside the layout of its main DOL.\n"+
+		"Pass \"disasm\" as the first argument to disassemble its main DOL instead; see \"inspect disasm -h\".")
+	path := flags.String("wad", "", "path to the WAD to inspect (default: the cached original WAD)")
+	symbolMap := flags.String("symbols", "", "path to a symbol map for the main DOL (default: that within the main ARC, if any)")
+	lookup := flags.String("lookup", "", "address or symbol within the main DOL to describe, such as 0x800acad0 or ec::isManagedTicket")
+	applyProfile := addProfileFlags(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if *path == "" {
+		*path = profile.originalWADPath()
+	} else {
+		*path = profile.resolvePath(*path)
+	}
+	if isFlagPassed(flags, "symbols") {
+		profile.Paths.SymbolMap = *symbolMap
+	}
+
+	wad, err := wadlib.LoadWADFromFile(*path)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+
+	tmd := wad.TMD
+	fmt.Printf("Title ID:      %016x\n", tmd.TitleID)
+	fmt.Printf("Title version: %d\n", tmd.TitleVersion)
+	fmt.Printf("Access rights: 0x%x\n", tmd.AccessRightsFlags)
+	fmt.Printf("Boot index:    %d\n", tmd.BootIndex)
+	fmt.Printf("Contents:      %d\n", tmd.NumberOfContents)
+
+	for _, record := range tmd.Contents {
+		contents, err := wad.GetContent(int(record.Index))
+		if err != nil {
+			return &CacheCorruptError{*path, err}
+		}
+
+		fmt.Printf("  [%d] ID %08x, %d bytes, SHA-1 %x\n", record.Index, record.ID, len(contents), sha1.Sum(contents))
+	}
+
+	// Only the Wii Shop Channel's main DOL and ARC are described further.
+	if tmd.TitleID != patcher.ShopTitleID {
+		return nil
+	}
+
+	dol, err := wad.GetContent(1)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+	layout, err := patcher.ParseDOL(dol)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+
+	symbols, source, err := loadInspectSymbols(profile, wad)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Main DOL entry point: 0x%08x\n", layout.EntryPoint)
+	for _, section := range layout.Sections {
+		fmt.Printf("  %-6s offset 0x%06x, address 0x%08x, 0x%06x bytes", section.Name, section.Offset, section.Address, section.Size)
+		if label := symbols.Label(section.Address); label != "" {
+			fmt.Printf(" (%s)", label)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  bss    address 0x%08x, 0x%06x bytes\n", layout.BSSAddress, layout.BSSSize)
+	fmt.Printf("Symbols: %d (%s)\n", len(symbols.Symbols()), source)
+
+	if *lookup != "" {
+		return printLookup(*lookup, layout, symbols)
+	}
+
+	return nil
+}
+
+// loadInspectSymbols loads the symbol map specified by the given profile or otherwise
+// that within the given WAD's main ARC, alongside a description of where it was loaded from.
+func loadInspectSymbols(profile Profile, wad *wadlib.WAD) (*patcher.SymbolMap, string, error) {
+	symbols, err := loadSymbolMap(profile)
+	if err != nil || symbols != nil {
+		return symbols, profile.symbolMapPath(), err
+	}
+
+	symbols, err = patcher.LoadSymbols(wad)
+	if err != nil {
+		return nil, "", err
+	}
+	if symbols == nil {
+		return nil, "none available", nil
+	}
+
+	return symbols, "main ARC", nil
+}
+
+// printLookup describes the given address or symbol within the main DOL.
+func printLookup(lookup string, layout *patcher.DOL, symbols *patcher.SymbolMap) error {
+	address, err := resolveReference(lookup, symbols)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: address 0x%08x", lookup, address)
+	if label := symbols.Label(address); label != "" {
+		fmt.Printf(", %s", label)
+	}
+
+	section := layout.SectionAtAddress(address)
+	if section == nil {
+		fmt.Println(", outside of any section")
+		return nil
+	}
+
+	offset, _ := layout.OffsetOf(address)
+	fmt.Printf(", %s, offset 0x%x\n", section.Name, offset)
+	return nil
+}
+
+// resolveReference returns the address of the given symbol within the symbol map,
+// or otherwise parses it as a hexadecimal address.
+func resolveReference(reference string, symbols *patcher.SymbolMap) (uint32, error) {
+	address, err := symbols.Resolve(reference)
+	if err == nil {
+		return address, nil
+	}
+
+	parsed, err := strconv.ParseUint(strings.TrimPrefix(reference, "0x"), 16, 32)
+	if err != nil {
+		return 0, &UsageError{fmt.Sprintf("\"%s\" is neither an address nor a symbol within the symbol map", reference)}
+	}
+
+	return uint32(parsed), nil
+}
+
+func runPatches(args []string) error {
+	flags := newFlagSet("patches", "Lists the identifiers of all patch sets, and the names of their patches.")
+	var patchFiles stringList
+	flags.Var(&patchFiles, "patch-file", "path to a YAML or JSON file defining an additional patch set to list; may be passed multiple times")
+	flags.Parse(args)
+
+	for _, named := range patcher.AvailablePatchSets {
+		set, err := named.Describe()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (%s)\n", aurora.Yellow(named.ID), set.Name)
+		for _, patch := range set.Patches {
+			printPatchName(patch.Name, patch.DependsOn)
+		}
+	}
+
+	// Patch files may reference symbols, so are listed as defined rather than created.
+	profile := defaultProfile()
+	profile.PatchFiles = patchFiles
+	definitions, err := loadPatchSetDefinitions(profile)
+	if err != nil {
+		return err
+	}
+
+	for _, definition := range definitions {
+		name := definition.Name
+		if name == "" {
+			name = definition.ID
+		}
+
+		fmt.Printf("%s (%s, from file)\n", aurora.Yellow(definition.ID), name)
+		for _, patch := range definition.Patches {
+			printPatchName(patch.Name, patch.DependsOn)
+		}
+	}
+
+	return nil
+}
+
+// printPatchName prints the name of a patch within a listed patch set, alongside its dependencies.
+func printPatchName(name string, dependsOn []string) {
+	fmt.Printf("  - %s\n", name)
+	if len(dependsOn) != 0 {
+		fmt.Printf("    depends on: %s\n", strings.Join(dependsOn, ", "))
+	}
+}
+
+func runVerify(args []string) error {
+	flags := newFlagSet("verify", "Verifies the original bytes of every DOL patch are present within the cached WAD.")
+	domain := flags.String("domain", patcher.NintendoBaseDomain, "base domain to verify patches with")
+	inputWad := flags.String("wad", "", "path to a Wii Shop Channel WAD to verify instead of the cached original, or - for standard input")
+	symbolMap := flags.String("symbols", "", "path to a symbol map for the main DOL (default: that within the main ARC, if any)")
+	applyProfile := addProfileFlags(flags)
+	applySelection := addSelectionFlags(flags)
+	applyVersion := addVersionFlag(flags)
+	applyUnknownDOL := addUnknownDOLFlag(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if err = applySelection(&profile); err != nil {
+		return err
+	}
+	if err = applyVersion(&profile); err != nil {
+		return err
+	}
+	applyUnknownDOL(&profile)
+	if profile.BaseDomain == "" || isFlagPassed(flags, "domain") {
+		profile.BaseDomain = *domain
+	}
+	if isFlagPassed(flags, "wad") {
+		profile.Paths.InputWAD = *inputWad
+	}
+	if isFlagPassed(flags, "symbols") {
+		profile.Paths.SymbolMap = *symbolMap
+	}
+	if err = validateBaseDomain(profile.BaseDomain); err != nil {
+		return err
+	}
+
+	// We only use an existing certificate, if any - verification should not issue new ones.
+	var rootCertificate []byte
+	if filePresent(profile.rootCertificatePath()) {
+		rootCertificate, err = loadRootCertificate(profile, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	options, err := profile.options(rootCertificate, nil)
+	if err != nil {
+		return err
+	}
+	options.Log = os.Stdout
+	wadPatcher, err := patcher.New(options)
+	if err != nil {
+		return err
+	}
+
+	originalWad, _, err := loadOriginalWAD(profile, false)
+	if err != nil {
+		return err
+	}
+
+	dol, err := originalWad.GetContent(1)
+	if err != nil {
+		return &CacheCorruptError{profile.inputWADPath(), err}
+	}
+
+	version, err := wadPatcher.Version(originalWad, dol)
+	if err != nil {
+		return err
+	}
+	symbols, err := wadPatcher.Symbols(originalWad)
+	if err != nil {
+		return err
+	}
+	sets, dol, err := wadPatcher.PatchSets(version, dol, symbols)
+	if err != nil {
+		return err
+	}
+
+	// Patches are applied against a copy, and never written out.
+	_, err = patcher.ApplySets(sets, append([]byte{}, dol...), os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.Green("All patches can be applied to the cached WAD."))
+	return nil
+}
+
+func runUnpatch(args []string) error {
+	flags := newFlagSet("unpatch", "Restores the original Wii Shop Channel from a WAD patched by WSC-Patcher, without downloading it.")
+	inputWad := flags.String("wad", "", "path to the patched WAD to restore, or - for standard input (default: the patched WAD within the output directory)")
+	output := flags.String("output", "", "path to write the restored WAD to (default: restored.wad within the output directory)")
+	symbolMap := flags.String("symbols", "", "path to the symbol map the WAD was patched with (default: that within the main ARC, if any)")
+	applyProfile := addProfileFlags(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if isFlagPassed(flags, "symbols") {
+		profile.Paths.SymbolMap = *symbolMap
+	}
+
+	path := profile.patchedWADPath()
+	if *inputWad != "" {
+		path = profile.resolvePath(*inputWad)
+		if *inputWad == stdinPath {
+			path = stdinPath
+		}
+	}
+	_, patched, err := loadInputWAD(path)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := loadSymbolMap(profile)
+	if err != nil {
+		return err
+	}
+
+	restored, err := patcher.Unpatch(patched, symbols, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	outputPath := profile.outputPath("restored.wad")
+	if *output != "" {
+		outputPath = profile.resolvePath(*output)
+	}
+	err = writeFile(outputPath, restored)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Restored the original WAD to %s.", outputPath)))
+	return nil
+}
+
+func runStatus(args []string) error {
+	flags := newFlagSet("status", "Reports which patches are present within any Wii Shop Channel WAD, alongside its base domain, certificates and filter list.")
+	inputWad := flags.String("wad", "", "path to the WAD to examine, or - for standard input (default: the patched WAD within the output directory)")
+	symbolMap := flags.String("symbols", "", "path to a symbol map for the main DOL (default: that within the main ARC, if any)")
+	asJSON := flags.Bool("json", false, "print the status as JSON")
+	applyProfile := addProfileFlags(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if isFlagPassed(flags, "symbols") {
+		profile.Paths.SymbolMap = *symbolMap
+	}
+
+	path := profile.patchedWADPath()
+	if *inputWad == stdinPath {
+		path = stdinPath
+	} else if *inputWad != "" {
+		path = profile.resolvePath(*inputWad)
+	}
+	_, contents, err := loadInputWAD(path)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := loadSymbolMap(profile)
+	if err != nil {
+		return err
+	}
+
+	status, err := patcher.Status(contents, symbols)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoded, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	printStatus(status)
+	return nil
+}
+
+// printStatus prints the given status in a human-readable form.
+func printStatus(status *patcher.StatusReport) {
+	baseDomain := status.BaseDomain
+	if baseDomain == "" {
+		baseDomain = "unknown"
+	}
+
+	fmt.Printf("Title version: %d\n", status.TitleVersion)
+	fmt.Printf("Access rights: 0x%x\n", status.AccessRights)
+	fmt.Printf("Base domain:   %s\n", baseDomain)
+	fmt.Printf("Restorable:    %t\n", status.Restorable)
+
+	if status.IOSCertificate != nil {
+		fmt.Printf("IOS root certificate: %s (SHA-1 %s)\n", status.IOSCertificate.Subject, status.IOSCertificate.SHA1)
+	} else {
+		fmt.Println("IOS root certificate: none")
+	}
+
+	fmt.Printf("Opera certificates: %d\n", len(status.OperaCertificates))
+	for _, certificate := range status.OperaCertificates {
+		fmt.Printf("  - %s (SHA-1 %s)\n", certificate.Subject, certificate.SHA1)
+	}
+
+	fmt.Println("Opera filter:")
+	for _, entry := range status.Filter.Include {
+		fmt.Printf("  include %s\n", entry)
+	}
+	for _, entry := range status.Filter.Exclude {
+		fmt.Printf("  exclude %s\n", entry)
+	}
+
+	for _, set := range status.PatchSets {
+		fmt.Printf("%s (%s)\n", aurora.Yellow(set.ID), set.Name)
+		for _, patch := range set.Patches {
+			fmt.Printf("  - %-45s %s\n", patch.Name, colorState(patch.State))
+		}
+	}
+}
+
+// colorState returns the given patch state, colored by whether it is expected.
+func colorState(state patcher.PatchState) aurora.Value {
+	switch state {
+	case patcher.PatchApplied:
+		return aurora.Green(state)
+	case patcher.PatchOriginal:
+		return aurora.Cyan(state)
+	default:
+		return aurora.Red(state)
+	}
+}
+
+func runApply(args []string) error {
+	flags := newFlagSet("apply", "Reconstructs a patched WAD from the original Wii Shop Channel and a delta written by patch -delta.")
+	deltaPath := flags.String("delta", "", "path to the delta to apply")
+	inputWad := flags.String("wad", "", "path to your original Wii Shop Channel WAD instead of the cached original, or - for standard input")
+	output := flags.String("output", "", "path to write the patched WAD to")
+	applyProfile := addProfileFlags(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if *deltaPath == "" {
+		return &UsageError{"a delta must be specified via -delta"}
+	}
+	*deltaPath = profile.resolvePath(*deltaPath)
+
+	contents, err := os.ReadFile(*deltaPath)
+	if err != nil {
+		return &IOError{*deltaPath, err}
+	}
+	delta, err := patcher.ParseDelta(contents)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *deltaPath, err)
+	}
+
+	// The delta determines which version of the original WAD is necessary.
+	profile.TitleVersion = delta.TitleVersion
+	if isFlagPassed(flags, "wad") {
+		profile.Paths.InputWAD = *inputWad
+	}
+	if isFlagPassed(flags, "output") {
+		profile.Paths.PatchedWAD = *output
+	}
+
+	_, original, err := loadOriginalWAD(profile, false)
+	if err != nil {
+		return err
+	}
+
+	patched, err := delta.Apply(original)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(profile.patchedWADPath(), patched)
+	if err != nil {
+		return err
+	}
+
+	if !delta.Matches(patched) {
+		fmt.Println(aurora.Yellow("All contents match, although the WAD differs from that the delta was created from. Your original WAD may have been packaged differently."))
+	}
+	fmt.Println(aurora.Green(fmt.Sprintf("Done! Install %s, sit back, and enjoy.", profile.patchedWADPath())))
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/wadlib"
+)
+
+// defaultDisasmLength is the amount of bytes disassembled when no length is given.
+const defaultDisasmLength = 0x40
+
+func runDisasm(args []string) error {
+	flags := newFlagSet("inspect disasm", "Disassembles a range of the main DOL within a WAD, or the contents of each selected patch.")
+	path := flags.String("wad", "", "path to the WAD to disassemble (default: the cached original WAD)")
+	symbolMap := flags.String("symbols", "", "path to a symbol map for the main DOL (default: that within the main ARC, if any)")
+	start := flags.String("start", "", "address or symbol to begin disassembling at, such as 0x800acad0 or ec::isManagedTicket")
+	length := flags.Uint("length", defaultDisasmLength, "amount of bytes to disassemble, truncated to the end of the section")
+	patches := flags.Bool("patches", false, "disassemble the original and replacement contents of each selected patch where it applies")
+	domain := flags.String("domain", "", "base domain to show patches for, alongside -patches")
+	applyProfile := addProfileFlags(flags)
+	applySelection := addSelectionFlags(flags)
+	applyUnknownDOL := addUnknownDOLFlag(flags)
+	flags.Parse(args)
+
+	profile, err := applyProfile()
+	if err != nil {
+		return err
+	}
+	if isFlagPassed(flags, "symbols") {
+		profile.Paths.SymbolMap = *symbolMap
+	}
+	if err = applySelection(&profile); err != nil {
+		return err
+	}
+	applyUnknownDOL(&profile)
+	if *start == "" && !*patches {
+		return &UsageError{"either -start or -patches must be specified"}
+	}
+	if isFlagPassed(flags, "domain") {
+		profile.BaseDomain = *domain
+	}
+	if *path == "" {
+		*path = profile.originalWADPath()
+	} else {
+		*path = profile.resolvePath(*path)
+	}
+
+	wad, err := wadlib.LoadWADFromFile(*path)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+	if wad.TMD.TitleID != patcher.ShopTitleID {
+		return &UsageError{fmt.Sprintf("%s is not a Wii Shop Channel WAD", *path)}
+	}
+
+	dol, err := wad.GetContent(1)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+	layout, err := patcher.ParseDOL(dol)
+	if err != nil {
+		return &CacheCorruptError{*path, err}
+	}
+
+	if *patches {
+		if err = validateBaseDomain(profile.BaseDomain); err != nil {
+			return err
+		}
+
+		return disassemblePatches(profile, wad, dol)
+	}
+
+	symbols, _, err := loadInspectSymbols(profile, wad)
+	if err != nil {
+		return err
+	}
+	address, err := resolveReference(*start, symbols)
+	if err != nil {
+		return err
+	}
+
+	section := layout.SectionAtAddress(address)
+	if section == nil {
+		return &UsageError{fmt.Sprintf("address 0x%08x is not within any section of the main DOL", address)}
+	}
+	if !section.IsText {
+		return &UsageError{fmt.Sprintf("address 0x%08x is within %s, which does not contain code", address, section.Name)}
+	}
+
+	// Instructions are word-aligned, so we begin at the one containing our address.
+	address &^= 3
+	size := uint32(*length)
+	if remaining := section.Address + section.Size - address; size > remaining {
+		size = remaining
+	}
+
+	offset, _ := layout.OffsetOf(address)
+	printDisassembly(dol[offset:offset+int(size)], address, symbols)
+	return nil
+}
+
+// printDisassembly prints the given instructions located at the given address alongside their bytes,
+// preceded by the name of each symbol beginning within them. Symbols may be nil.
+func printDisassembly(contents []byte, address uint32, symbols *patcher.SymbolMap) {
+	lines := patcher.DisassembleLabeled(contents, address, symbols)
+	for i, line := range lines {
+		current := address + uint32(i*4)
+		if symbol, ok := symbols.SymbolAt(current); ok && (symbol.Address == current || i == 0) {
+			fmt.Printf("%s:\n", aurora.Yellow(symbols.Label(current)))
+		}
+
+		fmt.Printf("  0x%08x  % x  %s\n", current, contents[i*4:i*4+4], line)
+	}
+}
+
+// disassemblePatches prints the original and replacement contents of every selected patch
+// where it first applies within the given DOL. Patches within data sections are shown as hex.
+func disassemblePatches(profile Profile, wad *wadlib.WAD, dol []byte) error {
+	wadPatcher, err := previewPatcher(profile)
+	if err != nil {
+		return err
+	}
+
+	version, err := wadPatcher.Version(wad, dol)
+	if err != nil {
+		return err
+	}
+	symbols, err := wadPatcher.Symbols(wad)
+	if err != nil {
+		return err
+	}
+	sets, dol, err := wadPatcher.PatchSets(version, dol, symbols)
+	if err != nil {
+		return err
+	}
+	layout, err := patcher.ParseDOL(dol)
+	if err != nil {
+		return err
+	}
+
+	// As with a dry run, later patches may rely on the result of earlier ones.
+	working := append([]byte{}, dol...)
+	for _, set := range sets {
+		fmt.Printf("Handling patch set \"%s\":\n", aurora.Yellow(set.Name))
+
+		for _, patch := range set.Patches {
+			offsets, err := patcher.LocatePatch(patch, working)
+			if err != nil {
+				fmt.Printf(" + %s %s\n", aurora.Cyan(patch.Name), aurora.Red(fmt.Sprintf("[%s]", err)))
+				continue
+			}
+			for _, offset := range offsets {
+				copy(working[offset:], patch.After)
+			}
+			if len(offsets) == 0 {
+				fmt.Printf(" + %s %s\n", aurora.Cyan(patch.Name), aurora.Yellow("[no occurrences]"))
+				continue
+			}
+
+			address, _ := layout.AddressOf(offsets[0])
+			if label := symbols.Label(address); label != "" {
+				fmt.Printf(" + %s at 0x%08x (%s)\n", aurora.Cyan(patch.Name), address, label)
+			} else {
+				fmt.Printf(" + %s at 0x%08x\n", aurora.Cyan(patch.Name), address)
+			}
+
+			printPatchContents("before", patch.Before, address, layout, symbols)
+			printPatchContents("after", patch.After, address, layout, symbols)
+		}
+	}
+
+	return nil
+}
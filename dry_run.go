@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/powerpc"
+)
+
+// maxDumpLength is the amount of bytes shown for a patch's contents
+// before truncation, so that large patches such as certificates remain legible.
+const maxDumpLength = 32
+
+// hexDump formats the given bytes as hex, truncating long contents.
+func hexDump(contents []byte) string {
+	if len(contents) == 0 {
+		return "(empty)"
+	}
+
+	if len(contents) > maxDumpLength {
+		return fmt.Sprintf("% x ... (%d bytes)", contents[:maxDumpLength], len(contents))
+	}
+
+	return fmt.Sprintf("% x", contents)
+}
+
+// printPatchContents prints the given patch contents located at the given address, disassembling them if they
+// reside within a text section, with branch targets labeled via the given symbols, which may be nil. Otherwise, they are printed as hex.
+func printPatchContents(label string, contents []byte, address uint32, layout *patcher.DOL, symbols *patcher.SymbolMap) {
+	section := layout.SectionAtAddress(address)
+	if section == nil || !section.IsText || address%4 != 0 || len(contents)%4 != 0 {
+		fmt.Printf("     %-7s %s\n", label+":", hexDump(contents))
+		return
+	}
+
+	fmt.Printf("     %s:\n", label)
+	lines := patcher.DisassembleLabeled(contents, address, symbols)
+	for i, line := range lines {
+		fmt.Printf("       0x%08x  % x  %s\n", address+uint32(i*4), contents[i*4:i*4+4], line)
+	}
+}
+
+// dryRun locates every patch within the given patch sets against a copy of the given DOL,
+// printing where each applies alongside its contents. Addresses are labeled via the given symbols, which may be nil.
+// Nothing is modified or written. If any patch would fail to apply, an error describing the first is returned.
+func dryRun(sets []powerpc.PatchSet, dol []byte, symbols *patcher.SymbolMap) error {
+	layout, err := patcher.ParseDOL(dol)
+	if err != nil {
+		return err
+	}
+
+	// Patches are applied to our copy as we go,
+	// as later patches may rely on the result of earlier ones.
+	working := append([]byte{}, dol...)
+	var firstErr error
+
+	for _, set := range sets {
+		fmt.Printf("Handling patch set \"%s\":\n", aurora.Yellow(set.Name))
+
+		for _, patch := range set.Patches {
+			offsets, err := patcher.LocatePatch(patch, working)
+			if err != nil {
+				fmt.Printf(" + %s %s\n", aurora.Cyan(patch.Name), aurora.Red(fmt.Sprintf("[%s]", err)))
+				fmt.Printf("     offset  0x%x\n", patch.AtOffset)
+				if firstErr == nil {
+					firstErr = &patcher.PatchError{SetName: set.Name, PatchName: patch.Name, Offset: patch.AtOffset, Err: err}
+				}
+				continue
+			}
+
+			if patch.AtOffset == 0 {
+				fmt.Printf(" + %s %s\n", aurora.Cyan(patch.Name), aurora.Green(fmt.Sprintf("[%d occurrences]", len(offsets))))
+			} else {
+				fmt.Printf(" + %s %s\n", aurora.Cyan(patch.Name), aurora.Green("[OK]"))
+			}
+
+			for _, offset := range offsets {
+				section := layout.SectionAtOffset(offset)
+				address, _ := layout.AddressOf(offset)
+				if label := symbols.Label(address); section != nil && label != "" {
+					fmt.Printf("     offset  0x%x (address 0x%08x, %s, %s)\n", offset, address, section.Name, label)
+				} else if section != nil {
+					fmt.Printf("     offset  0x%x (address 0x%08x, %s)\n", offset, address, section.Name)
+				} else {
+					fmt.Printf("     offset  0x%x (outside of any section)\n", offset)
+				}
+
+				copy(working[offset:], patch.After)
+			}
+
+			// All occurrences are identical, so we only need to show the first.
+			if len(offsets) != 0 {
+				address, _ := layout.AddressOf(offsets[0])
+				printPatchContents("before", patch.Before, address, layout, symbols)
+				printPatchContents("after", patch.After, address, layout, symbols)
+			}
+		}
+	}
+
+	return firstErr
+}
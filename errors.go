@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+)
+
+// ExitCode is the status WSC-Patcher exits with.
+// Each kind of failure has its own code, so that wrapping scripts may react accordingly.
+type ExitCode int
+
+const (
+	ExitSuccess             ExitCode = 0
+	ExitGeneral             ExitCode = 1
+	ExitUsage               ExitCode = 2
+	ExitDownloadFailed      ExitCode = 3
+	ExitCacheCorrupt        ExitCode = 4
+	ExitPatchMismatch       ExitCode = 5
+	ExitCertificateTooLarge ExitCode = 6
+	ExitARCFileMissing      ExitCode = 7
+	ExitInvalidProfile      ExitCode = 8
+	ExitIO                  ExitCode = 9
+	ExitUnsupportedTitle    ExitCode = 10
+	ExitPatchConflict       ExitCode = 11
+	ExitOutOfSpace          ExitCode = 12
+)
+
+// exitCoder is implemented by errors that have their own exit code.
+type exitCoder interface {
+	ExitCode() ExitCode
+}
+
+// exitCodeFor returns the exit code for the given error,
+// falling back to ExitGeneral for errors without one.
+func exitCodeFor(err error) ExitCode {
+	var coder exitCoder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+
+	var (
+		invalidWAD   *patcher.InvalidWADError
+		patchErr     *patcher.PatchError
+		signature    *patcher.SignatureError
+		address      *patcher.AddressError
+		symbol       *patcher.SymbolError
+		tooLarge     *patcher.CertificateTooLargeError
+		outOfSpace   *patcher.OutOfSpaceError
+		branchRange  *patcher.BranchRangeError
+		arcFileError *patcher.ARCFileMissingError
+		unsupported  *patcher.UnsupportedTitleError
+		unknownDOL   *patcher.UnknownDOLError
+		noOffset     *patcher.UnsupportedPatchError
+		overlap      *patcher.OverlapError
+		order        *patcher.DependencyOrderError
+		dependency   *patcher.UnknownDependencyError
+		branch       *patcher.BranchError
+		restoration  *patcher.RestorationError
+		delta        *patcher.DeltaMismatchError
+		definition   *patcher.PatchDefinitionError
+		assembly     *patcher.AssemblyError
+		unknownSet   *patcher.UnknownPatchSetError
+		unknownPatch *patcher.UnknownPatchError
+	)
+	switch {
+	case errors.As(err, &invalidWAD):
+		return ExitCacheCorrupt
+	case errors.As(err, &patchErr), errors.As(err, &signature), errors.As(err, &address), errors.As(err, &symbol), errors.As(err, &restoration), errors.As(err, &delta):
+		return ExitPatchMismatch
+	case errors.As(err, &tooLarge):
+		return ExitCertificateTooLarge
+	case errors.As(err, &outOfSpace), errors.As(err, &branchRange), errors.Is(err, patcher.ErrNoFreeSection):
+		return ExitOutOfSpace
+	case errors.As(err, &arcFileError):
+		return ExitARCFileMissing
+	case errors.As(err, &unsupported), errors.As(err, &unknownDOL), errors.As(err, &noOffset):
+		return ExitUnsupportedTitle
+	case errors.As(err, &definition), errors.As(err, &assembly), errors.As(err, &unknownSet), errors.As(err, &unknownPatch):
+		return ExitInvalidProfile
+	case errors.Is(err, patcher.ErrArenaLoNotFound), errors.Is(err, patcher.ErrSectionOverlap),
+		errors.Is(err, patcher.ErrSectionOutsideMEM1), errors.Is(err, patcher.ErrSectionWithinStack):
+		return ExitInvalidProfile
+	case errors.As(err, &overlap), errors.As(err, &order), errors.As(err, &dependency), errors.As(err, &branch):
+		return ExitPatchConflict
+	}
+
+	return ExitGeneral
+}
+
+// UsageError represents invalid arguments passed by the user.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func (e *UsageError) ExitCode() ExitCode {
+	return ExitUsage
+}
+
+// DownloadError represents a failure to download a title from NUS.
+type DownloadError struct {
+	Err error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("unable to download the original Wii Shop Channel: %v", e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DownloadError) ExitCode() ExitCode {
+	return ExitDownloadFailed
+}
+
+// CacheCorruptError represents a WAD that could not be loaded.
+type CacheCorruptError struct {
+	Path string
+	Err  error
+}
+
+func (e *CacheCorruptError) Error() string {
+	return fmt.Sprintf("the WAD at %s is corrupt or unreadable (remove it, or pass -download): %v", e.Path, e.Err)
+}
+
+func (e *CacheCorruptError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CacheCorruptError) ExitCode() ExitCode {
+	return ExitCacheCorrupt
+}
+
+// ProfileError represents a profile that could not be loaded or is invalid.
+type ProfileError struct {
+	Path string
+	Err  error
+}
+
+func (e *ProfileError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("invalid profile: %v", e.Err)
+	}
+
+	return fmt.Sprintf("invalid profile %s: %v", e.Path, e.Err)
+}
+
+func (e *ProfileError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProfileError) ExitCode() ExitCode {
+	return ExitInvalidProfile
+}
+
+// IOError represents a failure to read or write a file on disk.
+type IOError struct {
+	Path string
+	Err  error
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("unable to access %s: %v", e.Path, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+func (e *IOError) ExitCode() ExitCode {
+	return ExitIO
+}
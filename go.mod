@@ -9,3 +9,5 @@ require (
 	github.com/wii-tools/powerpc v0.0.0-20220518173947-5e34f2388e0d
 	github.com/wii-tools/wadlib v0.3.1
 )
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -3,10 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
 	"github.com/logrusorgru/aurora/v3"
 	"github.com/wii-tools/GoNUSD"
-	"github.com/wii-tools/arclib"
-	"github.com/wii-tools/powerpc"
 	"github.com/wii-tools/wadlib"
 	"io/fs"
 	"io/ioutil"
@@ -14,155 +13,303 @@ import (
 	"os"
 )
 
-// baseDomain holds our needed base domain.
-var baseDomain string
-
-// mainDol holds the main DOL - our content at index 1.
-var mainDol []byte
-
-// mainArc holds the main ARC - our content at index 2.
-var mainArc *arclib.ARC
-
-// rootCertificate holds the public certificate, in DER form, to be patched in.
-var rootCertificate []byte
-
 // filePresent returns whether the specified path is present on disk.
 func filePresent(path string) bool {
 	_, err := os.Stat(path)
 	return errors.Is(err, fs.ErrNotExist) == false
 }
 
-// createDir creates a directory at the given path if it is not already present.
-func createDir(path string) {
-	if !filePresent(path) {
-		os.Mkdir(path, 0755)
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(int(ExitUsage))
+	}
+
+	cmd := findCommand(os.Args[1])
+	if cmd == nil {
+		fmt.Printf("Unknown command \"%s\".\n", os.Args[1])
+		printUsage()
+		os.Exit(int(ExitUsage))
+	}
+
+	err := cmd.Run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red("Error:"), err)
+
+		var usage *UsageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(os.Stderr, "For more information, please refer to the README.")
+		}
+
+		var unknownDOL *patcher.UnknownDOLError
+		if errors.As(err, &unknownDOL) {
+			fmt.Fprintln(os.Stderr, "Pass -allow-unknown-dol to patch it regardless.")
+		}
+		if errors.Is(err, patcher.ErrAlreadyPatched) {
+			fmt.Fprintln(os.Stderr, "Pass -retarget to patch it anew.")
+		}
+
+		os.Exit(int(exitCodeFor(err)))
 	}
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Printf("Usage: %s <base domain>\n", os.Args[0])
-		fmt.Println("For more information, please refer to the README.")
-		os.Exit(-1)
+// validateBaseDomain ensures the given base domain can be patched in.
+func validateBaseDomain(domain string) error {
+	if domain == "" {
+		return &UsageError{"a base domain must be specified via -domain"}
 	}
 
-	baseDomain = os.Args[1]
-	if len(baseDomain) > 12 {
-		fmt.Println("The given base domain must not exceed 12 characters.")
-		fmt.Println("For more information, please refer to the README.")
-		os.Exit(-1)
+	if len(domain) > len(patcher.NintendoBaseDomain) {
+		return &UsageError{"the given base domain must not exceed 12 characters"}
 	}
 
-	fmt.Println("===========================")
-	fmt.Println("=       WSC-Patcher       =")
-	fmt.Println("===========================")
+	return nil
+}
 
-	// Create directories we may need later.
-	createDir("./output")
-	createDir("./cache")
+// writeDelta writes a delta reconstructing the given patched WAD from the given original WAD.
+func writeDelta(path string, original []byte, patched []byte) error {
+	delta, err := patcher.CreateDelta(original, patched)
+	if err != nil {
+		return err
+	}
 
-	var err error
+	contents, err := delta.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, contents)
+}
+
+// loadOriginalWAD loads the WAD to patch. If an input WAD was specified, it is read as-is.
+// Otherwise, the original Wii Shop Channel is loaded from our cache,
+// downloading a copy from NUS if it is not present or a download is forced.
+// It returns both the parsed WAD and its serialized form.
+func loadOriginalWAD(profile Profile, forceDownload bool) (*wadlib.WAD, []byte, error) {
+	if profile.Paths.InputWAD != "" {
+		if forceDownload {
+			return nil, nil, &UsageError{"a WAD cannot be both specified and downloaded"}
+		}
+
+		return loadInputWAD(profile.inputWADPath())
+	}
 
 	// Determine whether the Wii Shop Channel is cached.
-	if !filePresent("./cache/original.wad") {
-		log.Println("Downloading a copy of the original Wii Shop Channel, please wait...")
-		var downloadedShop *wadlib.WAD
-		downloadedShop, err = GoNUSD.Download(0x00010002_48414241, 21, true)
-		check(err)
+	if forceDownload || !filePresent(profile.originalWADPath()) {
+		log.Printf("Downloading a copy of version %d of the original Wii Shop Channel, please wait...\n", profile.TitleVersion)
+		downloadedShop, err := GoNUSD.Download(patcher.ShopTitleID, profile.TitleVersion, true)
+		if err != nil {
+			return nil, nil, &DownloadError{err}
+		}
 
 		// Cache this downloaded WAD to disk.
-		var contents []byte
-		contents, err = downloadedShop.GetWAD(wadlib.WADTypeCommon)
-		check(err)
+		contents, err := downloadedShop.GetWAD(wadlib.WADTypeCommon)
+		if err != nil {
+			return nil, nil, &DownloadError{err}
+		}
+
+		err = writeFile(profile.originalWADPath(), contents)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	contents, err := ioutil.ReadFile(profile.originalWADPath())
+	if err != nil {
+		return nil, nil, &IOError{profile.originalWADPath(), err}
+	}
+
+	originalWad, err := patcher.LoadWAD(contents)
+	var invalid *patcher.InvalidWADError
+	if errors.As(err, &invalid) {
+		return nil, nil, &CacheCorruptError{profile.originalWADPath(), invalid.Err}
+	} else if err != nil {
+		return nil, nil, err
+	}
 
-		os.WriteFile("./cache/original.wad", contents, 0755)
+	// Our cache should only ever contain the version we downloaded.
+	if originalWad.TMD.TitleVersion != profile.TitleVersion {
+		err = fmt.Errorf("expected version %d, but found version %d", profile.TitleVersion, originalWad.TMD.TitleVersion)
+		return nil, nil, &CacheCorruptError{profile.originalWADPath(), err}
 	}
 
-	var originalWad *wadlib.WAD
-	originalWad, err = wadlib.LoadWADFromFile("./cache/original.wad")
-	check(err)
+	return originalWad, contents, nil
+}
+
+// loadInputWAD loads a user-supplied WAD from the given path, or standard input.
+func loadInputWAD(path string) (*wadlib.WAD, []byte, error) {
+	var contents []byte
+	var err error
+	if path == stdinPath {
+		contents, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		contents, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, nil, &IOError{path, err}
+	}
+
+	inputWad, err := patcher.LoadWAD(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return inputWad, contents, nil
+}
+
+// loadRootCertificate loads the root certificate specified by the given profile, in DER form.
+// If one has not been provided or generated previously, or regeneration
+// is requested, new certificates will be issued for the profile's base domain.
+func loadRootCertificate(profile Profile, regenerate bool) ([]byte, error) {
+	var rootCertificate []byte
+	var err error
 
 	// Determine whether a certificate authority was provided, or generated previously.
-	if !filePresent("./output/root.cer") {
+	if regenerate || !filePresent(profile.rootCertificatePath()) {
 		fmt.Println(aurora.Green("Generating root certificates..."))
-		rootCertificate = createCertificates()
+		rootCertificate, err = createCertificates(profile)
 	} else {
-		rootCertificate, err = ioutil.ReadFile("./output/root.cer")
-		check(err)
+		rootCertificate, err = ioutil.ReadFile(profile.rootCertificatePath())
+		if err != nil {
+			err = &IOError{profile.rootCertificatePath(), err}
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Ensure the loaded certificate has a suitable length.
-	// It must not be longer than 928 bytes.
-	if len(rootCertificate) > 928 {
-		fmt.Println("The passed root certificate exceeds the maximum length possible, 928 bytes.")
-		fmt.Println("Please verify parameters passed for generation and reduce its size.")
-		os.Exit(-1)
-	}
-
-	// Load main DOL
-	mainDol, err = originalWad.GetContent(1)
-	check(err)
-
-	// Permit r/w access to MEM2_PROT via the TMD.
-	// See docs/patch_overwrite_ios.md for more information!
-	originalWad.TMD.AccessRightsFlags = 0x3
-	// Apply all DOL patches
-	fmt.Println(aurora.Green("Applying DOL patches..."))
-	applyDefaultPatches()
-
-	// Save main DOL
-	err = originalWad.UpdateContent(1, mainDol)
-	check(err)
-
-	// Load main ARC
-	arcData, err := originalWad.GetContent(2)
-	check(err)
-	mainArc, err = arclib.Load(arcData)
-	check(err)
-
-	// Generate filter list and certificate store
-	fmt.Println(aurora.Green("Applying Opera patches..."))
-	modifyAllowList()
-	generateOperaCertStore()
-
-	// Save main ARC
-	updated, err := mainArc.Save()
-	check(err)
-	err = originalWad.UpdateContent(2, updated)
-	check(err)
-
-	// Generate a patched WAD with our changes
-	output, err := originalWad.GetWAD(wadlib.WADTypeCommon)
-	check(err)
-
-	fmt.Println(aurora.Green("Done! Install ./output/patched.wad, sit back, and enjoy."))
-	writeOut("patched.wad", output)
+	if maximum := profile.Sections.MaxCertificateLength(); len(rootCertificate) > maximum {
+		return nil, &patcher.CertificateTooLargeError{Size: len(rootCertificate), Maximum: maximum}
+	}
+
+	return rootCertificate, nil
 }
 
-// applyDefaultPatches applies the default patches to our main DOL.
-func applyDefaultPatches() {
-	var err error
+// createCertificates issues a root CA and wildcard server certificate for the profile's base domain,
+// persisting both to its output directory, or the root certificate's configured path. It returns the root certificate in DER form.
+func createCertificates(profile Profile) ([]byte, error) {
+	certificates, err := patcher.CreateCertificates(profile.BaseDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	// The root certificate in DER form is written to its configured path, so that it is found when next loaded.
+	persisted := map[string][]byte{
+		profile.outputPath("root.pem"):   certificates.RootCertificatePEM,
+		profile.rootCertificatePath():    certificates.RootCertificate,
+		profile.outputPath("root.key"):   certificates.RootKeyPEM,
+		profile.outputPath("server.pem"): certificates.ServerCertificatePEM,
+		profile.outputPath("server.key"): certificates.ServerKeyPEM,
+	}
+	for path, contents := range persisted {
+		if err = writeFile(path, contents); err != nil {
+			return nil, err
+		}
+	}
 
-	mainDol, err = powerpc.ApplyPatchSet(OverwriteIOSPatch, mainDol)
-	check(err)
-	mainDol, err = powerpc.ApplyPatchSet(LoadCustomCA(), mainDol)
-	check(err)
-	mainDol, err = powerpc.ApplyPatchSet(PatchBaseDomain(), mainDol)
-	check(err)
-	mainDol, err = powerpc.ApplyPatchSet(NegateECTitle, mainDol)
-	check(err)
-	mainDol, err = powerpc.ApplyPatchSet(PatchECCfgPath, mainDol)
-	check(err)
+	return certificates.RootCertificate, nil
 }
 
-// check has an anxiety attack if things go awry.
-func check(err error) {
+// loadSymbolMap loads the symbol map specified by the given profile.
+// It returns nil if none was specified, so that the main ARC's is used.
+func loadSymbolMap(profile Profile) (*patcher.SymbolMap, error) {
+	path := profile.symbolMapPath()
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, &IOError{path, err}
 	}
+
+	symbols, err := patcher.ParseSymbolMap(contents)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("unable to parse symbol map %s: %v", path, err)}
+	}
+
+	return symbols, nil
+}
+
+// loadPatchSetDefinitions loads the patch sets defined within the patch files specified by the given profile.
+func loadPatchSetDefinitions(profile Profile) ([]patcher.PatchSetDefinition, error) {
+	var definitions []patcher.PatchSetDefinition
+	for _, path := range profile.PatchFiles {
+		path = profile.resolvePath(path)
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, &IOError{path, err}
+		}
+
+		definition, err := patcher.ParsePatchSetDefinition(contents)
+		if err != nil {
+			return nil, fmt.Errorf("patch file %s: %w", path, err)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	if err := patcher.ValidateDefinitions(definitions); err != nil {
+		return nil, err
+	}
+
+	return definitions, nil
 }
 
-// writeOut writes a file with the given name and contents to the output folder.
-func writeOut(filename string, contents []byte) {
-	os.WriteFile("./output/"+filename, contents, 0755)
+// patchWAD patches the given original WAD with the given root certificate,
+// writing the result to the path specified by the given profile. If retarget is set,
+// the WAD may have been patched previously, and is retargeted via Patcher.Retarget.
+func patchWAD(profile Profile, original []byte, rootCertificate []byte, retarget bool) error {
+	serverCertificate, err := loadServerCertificate(profile)
+	if err != nil {
+		return err
+	}
+
+	options, err := profile.options(rootCertificate, serverCertificate)
+	if err != nil {
+		return err
+	}
+	options.Log = os.Stdout
+	wadPatcher, err := patcher.New(options)
+	if err != nil {
+		return err
+	}
+
+	patch := wadPatcher.Patch
+	if retarget {
+		patch = wadPatcher.Retarget
+	}
+
+	output, report, err := patch(original)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(profile.patchedWADPath(), output)
+	if err != nil {
+		return err
+	}
+
+	if profile.deltaPath() != "" {
+		err = writeDelta(profile.deltaPath(), original, output)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(aurora.Green(fmt.Sprintf("A delta is available at %s.", profile.deltaPath())))
+	}
+
+	if profile.reportPath() != "" {
+		report.Input.Path = profile.inputWADPath()
+		report.Output.Path = profile.patchedWADPath()
+		err = writeReport(profile.reportPath(), report)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(aurora.Green(fmt.Sprintf("A build report is available at %s.", profile.reportPath())))
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Done! Install %s, sit back, and enjoy.", profile.patchedWADPath())))
+	return nil
 }
@@ -0,0 +1,133 @@
+package patcher
+
+// FreeRegion describes space within the main DOL that patches may place their own code or data within.
+// All free regions must consist of null bytes, either within the original DOL or once freed by a patch.
+type FreeRegion struct {
+	// Name describes this region, for usage within errors.
+	Name string
+
+	// Address is the virtual address this region begins at.
+	Address uint32
+
+	// Size is the length of this region.
+	Size uint32
+
+	// Executable is whether this region resides within a text section, and may contain code.
+	// Code is only allocated within executable regions, and data only within others.
+	Executable bool
+
+	// FreedBy names the patch clearing this region, if it is not already free within the original DOL.
+	// This region is unavailable if that patch is disabled. If its patch set is not selected,
+	// patches placed within this region fail to apply, as its original bytes remain.
+	FreedBy string
+}
+
+// Allocation describes space allocated within a free region.
+type Allocation struct {
+	// Name describes what this space is utilized for.
+	Name string
+
+	// Region is the name of the free region this space resides within.
+	Region string
+
+	// Address is the virtual address this space begins at.
+	Address uint32
+
+	// Size is the length of this space.
+	Size uint32
+}
+
+// Allocator hands out space within free regions of the main DOL, so that patches need not hardcode where
+// their code and data reside. Space is allocated from the smallest region able to hold it,
+// preserving larger regions for larger requests. It is not safe for concurrent use.
+type Allocator struct {
+	// remaining contains the space left within each free region.
+	remaining []FreeRegion
+
+	// allocations contains all space allocated, in order.
+	allocations []Allocation
+}
+
+// NewAllocator returns an allocator for the given free regions.
+func NewAllocator(regions []FreeRegion) *Allocator {
+	return &Allocator{
+		remaining: append([]FreeRegion{}, regions...),
+	}
+}
+
+// Allocate returns the address of size bytes with the given alignment, within an executable region if requested.
+// The given name describes what the space is utilized for. An alignment of zero is treated as one.
+// If no region has sufficient space remaining, an OutOfSpaceError is returned.
+func (a *Allocator) Allocate(name string, size uint32, alignment uint32, executable bool) (uint32, error) {
+	return a.AllocateNear(name, size, alignment, executable, 0, 0)
+}
+
+// AllocateNear is similar to Allocate, but only places space beginning less than reach bytes from the given address,
+// such as where a branch with a limited displacement is able to target. Regions beyond its reach, such as appended
+// sections, are not considered. A reach of zero permits any address.
+func (a *Allocator) AllocateNear(name string, size uint32, alignment uint32, executable bool, from uint32, reach uint32) (uint32, error) {
+	if alignment == 0 {
+		alignment = 1
+	}
+
+	best := -1
+	var bestAddress uint32
+	for i, region := range a.remaining {
+		if region.Executable != executable {
+			continue
+		}
+
+		// Ensure our aligned space fits within what remains of this region.
+		address := alignUp(region.Address, alignment)
+		end := uint64(region.Address) + uint64(region.Size)
+		if uint64(address)+uint64(size) > end {
+			continue
+		}
+		if reach != 0 && !withinReach(address, from, reach) {
+			continue
+		}
+
+		if best == -1 || region.Size < a.remaining[best].Size {
+			best = i
+			bestAddress = address
+		}
+	}
+
+	if best == -1 {
+		return 0, &OutOfSpaceError{name, size, alignment, executable, from, reach}
+	}
+
+	region := &a.remaining[best]
+	region.Size -= bestAddress + size - region.Address
+	region.Address = bestAddress + size
+
+	a.allocations = append(a.allocations, Allocation{
+		Name:    name,
+		Region:  region.Name,
+		Address: bestAddress,
+		Size:    size,
+	})
+
+	return bestAddress, nil
+}
+
+// Allocations returns all space allocated thus far, in order.
+func (a *Allocator) Allocations() []Allocation {
+	return append([]Allocation{}, a.allocations...)
+}
+
+// withinReach returns whether the given address lies less than reach bytes from the given origin.
+func withinReach(address uint32, from uint32, reach uint32) bool {
+	distance := int64(address) - int64(from)
+	return distance > -int64(reach) && distance < int64(reach)
+}
+
+// alignUp rounds the given address up to the given alignment.
+func alignUp(address uint32, alignment uint32) uint32 {
+	remainder := address % alignment
+	if remainder == 0 {
+		return address
+	}
+
+	return address + alignment - remainder
+}
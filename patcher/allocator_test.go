@@ -0,0 +1,125 @@
+package patcher
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAllocatorAllocate(t *testing.T) {
+	space := NewAllocator([]FreeRegion{
+		{Name: "large code", Address: 0x80004000, Size: 0x100, Executable: true},
+		{Name: "small code", Address: 0x80005002, Size: 0x20, Executable: true},
+		{Name: "data", Address: 0x80300000, Size: 0x40},
+	})
+
+	tests := []struct {
+		name       string
+		size       uint32
+		alignment  uint32
+		executable bool
+		address    uint32
+		region     string
+	}{
+		// The smallest region able to hold our space is preferred.
+		{"aligned code", 0x10, 4, true, 0x80005004, "small code"},
+		{"remaining code", 0x10, 4, true, 0x80004000, "large code"},
+		{"unaligned data", 0x3, 0, false, 0x80300000, "data"},
+		{"aligned data", 0x20, 32, false, 0x80300020, "data"},
+	}
+	for i, test := range tests {
+		address, err := space.Allocate(test.name, test.size, test.alignment, test.executable)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if address != test.address {
+			t.Errorf("%s: allocated at 0x%08x, expected 0x%08x", test.name, address, test.address)
+		}
+		if allocation := space.Allocations()[i]; allocation.Region != test.region {
+			t.Errorf("%s: allocated within \"%s\", expected \"%s\"", test.name, allocation.Region, test.region)
+		}
+	}
+
+	_, err := space.Allocate("exhausted data", 0x1, 1, false)
+	if _, ok := err.(*OutOfSpaceError); !ok {
+		t.Fatalf("expected an OutOfSpaceError, but received %v", err)
+	}
+}
+
+func TestAllocatorAllocateNear(t *testing.T) {
+	space := NewAllocator([]FreeRegion{
+		{Name: "distant", Address: 0x80422000, Size: 0x10, Executable: true},
+		{Name: "nearby", Address: 0x80014000, Size: 0x100, Executable: true},
+	})
+
+	// The smallest region is preferred only if within reach.
+	address, err := space.AllocateNear("code", 0x10, 4, true, 0x80017160, 0x8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != 0x80014000 {
+		t.Fatalf("allocated at 0x%08x, rather than within reach at 0x80014000", address)
+	}
+
+	_, err = space.AllocateNear("unreachable code", 0x10, 4, true, 0x80100000, 0x8000)
+	if _, ok := err.(*OutOfSpaceError); !ok {
+		t.Fatalf("expected an OutOfSpaceError, but received %v", err)
+	}
+}
+
+func TestOverwriteIOSPatchBranchesToAllocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    uint32
+		branch  []byte
+		inRange bool
+	}{
+		{"freed functions", 0x800143f4, []byte{0x42, 0x80, 0xd2, 0x94}, true},
+		{"after ipl::Exception::__ct", 0x80017200, []byte{0x42, 0x80, 0x00, 0xa0}, true},
+		{"out of range", 0x80100000, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := OverwriteIOSPatch(NewAllocator([]FreeRegion{
+				{Name: "table", Address: 0x803126e0, Size: 52},
+				{Name: "code", Address: test.code, Size: 108, Executable: true},
+			}))
+			if !test.inRange {
+				if _, ok := err.(*OutOfSpaceError); !ok {
+					t.Fatalf("expected an OutOfSpaceError, but received %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, patch := range set.Patches {
+				if patch.Name == "Modify ipl::Exception::__ct" && !bytes.Equal(patch.After, test.branch) {
+					t.Fatalf("branches via %x, expected %x", patch.After, test.branch)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchRejectsUnreachableAllocations(t *testing.T) {
+	// Without clearing extraneous functions, only our appended text section may hold overwriteIOSMemory,
+	// which lies beyond the reach of ipl::Exception::__ct.
+	p, err := New(Options{
+		BaseDomain:      "a.taur.cloud",
+		RootCertificate: testCertificate(t),
+		PatchSets:       DefaultPatchSets(),
+		DisabledPatches: []string{"Clear extraneous functions"},
+		Sections:        Sections{TextSize: 0x100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = p.Patch(testWAD(t, testDOL(t), testARC(t, []byte("[include]\r\n"), []byte{0, 0, 0x10, 0})))
+	var outOfSpace *OutOfSpaceError
+	if !errors.As(err, &outOfSpace) || outOfSpace.Name != "overwriteIOSMemory" {
+		t.Fatalf("expected an OutOfSpaceError for overwriteIOSMemory, but received %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package patcher
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/powerpc"
+	"io"
+)
+
+// LocatePatch returns all file offsets the given patch applies to within the binary.
+// Patches without an offset are located by searching for their original bytes.
+func LocatePatch(patch powerpc.Patch, binary []byte) ([]int, error) {
+	if len(patch.Before) != len(patch.After) {
+		return nil, powerpc.ErrInconsistentPatch
+	}
+
+	if patch.AtOffset == 0 {
+		offsets := []int{}
+		if len(patch.Before) == 0 {
+			return offsets, nil
+		}
+
+		for start := 0; ; {
+			found := bytes.Index(binary[start:], patch.Before)
+			if found == -1 {
+				break
+			}
+
+			offsets = append(offsets, start+found)
+			start += found + len(patch.Before)
+		}
+
+		return offsets, nil
+	}
+
+	if patch.AtOffset+len(patch.Before) > len(binary) {
+		return nil, powerpc.ErrPatchOutOfRange
+	}
+
+	if !bytes.Equal(binary[patch.AtOffset:patch.AtOffset+len(patch.Before)], patch.Before) {
+		return nil, powerpc.ErrInvalidPatch
+	}
+
+	return []int{patch.AtOffset}, nil
+}
+
+// ApplySet applies the given patch set to the binary in place,
+// logging its name to the given writer similar to powerpc.ApplyPatchSet.
+// Unlike it, we record all offsets each patch was applied at.
+// If log is nil, nothing is logged.
+func ApplySet(set powerpc.PatchSet, binary []byte, log io.Writer) (PatchSetReport, error) {
+	log = logWriter(log)
+	if set.Name != "" {
+		fmt.Fprintf(log, "Handling patch set \"%s\":\n", aurora.Yellow(set.Name))
+	}
+
+	setReport := PatchSetReport{
+		Name: set.Name,
+	}
+
+	for _, patch := range set.Patches {
+		if patch.Name != "" {
+			fmt.Fprintln(log, " + Applying patch", aurora.Cyan(patch.Name))
+		}
+
+		offsets, err := LocatePatch(patch, binary)
+		if err != nil {
+			return PatchSetReport{}, &PatchError{set.Name, patch.Name, patch.AtOffset, err}
+		}
+
+		for _, offset := range offsets {
+			copy(binary[offset:], patch.After)
+		}
+
+		setReport.Patches = append(setReport.Patches, PatchReport{
+			Name:    patch.Name,
+			Offsets: offsets,
+			Length:  len(patch.After),
+		})
+	}
+
+	return setReport, nil
+}
+
+// ApplySets applies all given patch sets to the binary in place, logging to the given writer.
+func ApplySets(sets []powerpc.PatchSet, binary []byte, log io.Writer) ([]PatchSetReport, error) {
+	var reports []PatchSetReport
+	for _, set := range sets {
+		setReport, err := ApplySet(set, binary, log)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, setReport)
+	}
+
+	return reports, nil
+}
+
+// logWriter returns the given writer, or one discarding all output if nil.
+func logWriter(log io.Writer) io.Writer {
+	if log == nil {
+		return io.Discard
+	}
+
+	return log
+}
@@ -0,0 +1,143 @@
+package patcher
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// mem1Start and mem1End bound MEM1 as mapped for the main DOL. All sections must reside within it.
+	mem1Start uint32 = 0x80000000
+	mem1End   uint32 = 0x81800000
+
+	// linkerStackSize and linkerDebugStackSize are the sizes of the stack and debugger stack
+	// Nintendo's linker places between the BSS and __ArenaLo.
+	linkerStackSize      = 0x10000
+	linkerDebugStackSize = 0x2000
+
+	// arenaLoadDistance is how many instructions may separate the two halves of a load of __ArenaLo.
+	arenaLoadDistance = 8
+)
+
+var ErrArenaLoNotFound = errors.New("unable to locate where __ArenaLo is loaded within the main DOL; please provide a symbol map containing it")
+
+// arenaLoad describes an instruction pair loading __ArenaLo, such as within OSInit.
+type arenaLoad struct {
+	// high and low are the file offsets of the instruction loading the upper half of __ArenaLo
+	// via lis, and that adding its lower half via addi or ori.
+	high int
+	low  int
+}
+
+// arenaLoAddress returns the address of __ArenaLo within the original main DOL, where the arena for dynamic allocations begins.
+// It is read from the given symbol map if present, and is otherwise expected to follow the BSS, stack and debugger stack
+// as placed by Nintendo's linker.
+func arenaLoAddress(layout *DOL, symbols *SymbolMap) uint32 {
+	if arenaLo, ok := symbols.Lookup("__ArenaLo"); ok {
+		return arenaLo.Address
+	}
+
+	stackAddress := alignUp(layout.BSSAddress+layout.BSSSize+linkerStackSize, 8)
+	return alignUp(stackAddress+linkerDebugStackSize, 32)
+}
+
+// findArenaLoads returns every instruction pair within the given main DOL's text sections loading any of the given values,
+// such as __ArenaLo prior to and once raised.
+func findArenaLoads(dol []byte, layout *DOL, values ...uint32) []arenaLoad {
+	var loads []arenaLoad
+	for _, section := range layout.Sections {
+		if !section.IsText {
+			continue
+		}
+
+		start, end := int(section.Offset), int(section.Offset+section.Size)
+		for high := start; high+4 <= end; high += 4 {
+			// lis rD, value@ha or value@h
+			word := binary.BigEndian.Uint32(dol[high:])
+			if word>>26 != 15 || word>>16&0x1f != 0 {
+				continue
+			}
+
+			// The register is expected to be utilized next by addi or ori.
+			register := word >> 21 & 0x1f
+			for low := high + 4; low+4 <= end && low <= high+arenaLoadDistance*4; low += 4 {
+				lower := binary.BigEndian.Uint32(dol[low:])
+				if lower>>16&0x1f != register {
+					continue
+				}
+
+				for _, value := range values {
+					if loadedValue(word, lower) == value {
+						loads = append(loads, arenaLoad{high, low})
+						break
+					}
+				}
+				break
+			}
+		}
+	}
+
+	return loads
+}
+
+// loadedValue returns the value loaded by the given lis instruction followed by the given instruction
+// upon the same register, or zero if it is neither addi nor ori.
+func loadedValue(high uint32, low uint32) uint32 {
+	upper := high << 16
+	switch low >> 26 {
+	case 14:
+		// addi sign-extends its immediate.
+		return upper + uint32(int32(int16(low)))
+	case 24:
+		return upper | low&0xffff
+	}
+
+	return 0
+}
+
+// withLoadedValue returns the given instruction pair loading the given value instead.
+func withLoadedValue(high uint32, low uint32, value uint32) (uint32, uint32) {
+	upper, lower := value>>16, value&0xffff
+	if low>>26 == 14 && lower&0x8000 != 0 {
+		// Account for addi sign-extending its immediate.
+		upper++
+	}
+
+	return high&0xffff0000 | upper&0xffff, low&0xffff0000 | lower
+}
+
+// raiseArenaLo returns patches raising every given load of __ArenaLo from the given original address to the given address,
+// reserving the memory between them from the arena. Loads may already be raised, such as within a patched DOL.
+func raiseArenaLo(dol []byte, layout *DOL, loads []arenaLoad, original uint32, raised uint32) []DOLPatch {
+	var patches []DOLPatch
+	for _, load := range loads {
+		high := binary.BigEndian.Uint32(dol[load.high:])
+		low := binary.BigEndian.Uint32(dol[load.low:])
+		highBefore, lowBefore := withLoadedValue(high, low, original)
+		highAfter, lowAfter := withLoadedValue(high, low, raised)
+
+		for _, replaced := range []struct {
+			offset int
+			before uint32
+			after  uint32
+		}{{load.high, highBefore, highAfter}, {load.low, lowBefore, lowAfter}} {
+			instruction, _ := layout.AddressOf(replaced.offset)
+			patches = append(patches, DOLPatch{
+				Name:      fmt.Sprintf("Raise __ArenaLo at 0x%08x", instruction),
+				AtAddress: instruction,
+				Before:    wordBytes(replaced.before),
+				After:     wordBytes(replaced.after),
+			})
+		}
+	}
+
+	return patches
+}
+
+// wordBytes returns the given word in big-endian form.
+func wordBytes(word uint32) []byte {
+	contents := make([]byte, 4)
+	binary.BigEndian.PutUint32(contents, word)
+	return contents
+}
@@ -0,0 +1,1133 @@
+package patcher
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wii-tools/powerpc"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// assembler encodes instructions in the mnemonic form produced by Disassemble.
+type assembler struct {
+	// address is the virtual address of the instruction being assembled,
+	// against which relative branches are computed.
+	address uint32
+
+	// resolve returns the address of a symbol referenced by an operand.
+	resolve func(name string) (uint32, error)
+}
+
+// mnemonic describes how to encode an instruction, and which suffixes it permits.
+type mnemonic struct {
+	encode func(a *assembler, ops []string) (uint32, error)
+
+	// record is whether a "." suffix may be appended, setting the Rc bit.
+	record bool
+
+	// overflow is whether an "o" suffix may be appended, setting the OE bit.
+	overflow bool
+}
+
+// mnemonics maps the name of every instruction we are able to assemble to its encoding.
+var mnemonics = newMnemonics()
+
+// Labels maps names to addresses, permitting assembly to reference locations outside of itself,
+// such as functions or space allocated for a patch.
+type Labels map[string]uint32
+
+// labelPattern matches a label preceding a line's contents, such as "loop:" or "ec::isManagedTicket:".
+var labelPattern = regexp.MustCompile(`^([A-Za-z_.$][\w.$]*(?:::[A-Za-z_.$][\w.$]*)*):(?:\s+|$)`)
+
+// AssembleSource assembles Gekko/Broadway assembly as located at the given address,
+// returning its contents alongside the address of every label it defines.
+//
+// Each line contains an instruction, a directive, or nothing, and may begin with labels such as "loop:".
+// Comments begin with "#" or "//". Instructions are in the form produced by Disassemble, such as "li r3, 0x1",
+// and branch to either addresses or names, such as "beq loop" or "bl 0x80012345". The ".long value" directive
+// emits a word, and ".space length" emits null bytes.
+//
+// Names are resolved against labels within the source, then the given labels, and lastly the given symbol map,
+// which may be nil. A suffix of "@ha", "@h" or "@l" selects a half of the resolved address, such as within
+// "lis r3, SSLSetRootCA@ha" alongside "addi r3, r3, SSLSetRootCA@l".
+func AssembleSource(source string, address uint32, labels Labels, symbols *SymbolMap) ([]byte, Labels, error) {
+	return assemble(source, address, func(name string) (uint32, error) {
+		if resolved, ok := labels[name]; ok {
+			return resolved, nil
+		}
+
+		return symbols.Resolve(name)
+	})
+}
+
+// MustAssemble is similar to AssembleSource without a symbol map, but panics upon error.
+// It is intended for patches defined within code, and only suitable for source that cannot fail to assemble,
+// such as that not branching to allocated space.
+func MustAssemble(source string, address uint32, labels Labels) []byte {
+	contents, _, err := AssembleSource(source, address, labels, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return contents
+}
+
+// MustAssembleLabeled is similar to MustAssemble, but additionally returns the given labels
+// alongside those defined within the source, as declared by DOLPatch.Labels.
+func MustAssembleLabeled(source string, address uint32, labels Labels) ([]byte, Labels) {
+	contents, defined, err := AssembleSource(source, address, labels, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return contents, labels.with(defined)
+}
+
+// with returns a copy of these labels alongside the given labels, which take precedence.
+func (l Labels) with(other Labels) Labels {
+	merged := Labels{}
+	for name, address := range l {
+		merged[name] = address
+	}
+	for name, address := range other {
+		merged[name] = address
+	}
+
+	return merged
+}
+
+// Assemble assembles the given lines as located at the given address, as with AssembleSource.
+// Names are resolved against the given symbol map, which may be nil.
+func Assemble(lines []string, address uint32, symbols *SymbolMap) ([]byte, error) {
+	contents, _, err := AssembleSource(strings.Join(lines, "\n"), address, nil, symbols)
+	return contents, err
+}
+
+// AssembleInstruction assembles a single instruction located at the given address, as with Assemble.
+func AssembleInstruction(line string, address uint32, symbols *SymbolMap) (powerpc.Instruction, error) {
+	a := &assembler{address, symbols.Resolve}
+	word, err := a.instruction(line)
+	if err != nil {
+		return powerpc.Instruction{}, &AssemblyError{1, line, err}
+	}
+
+	var instr powerpc.Instruction
+	binary.BigEndian.PutUint32(instr[:], word)
+	return instr, nil
+}
+
+// statement is a single line of source containing an instruction or directive, located at an address.
+type statement struct {
+	line    int
+	source  string
+	text    string
+	address uint32
+
+	// space is the length of null bytes emitted by a .space directive.
+	space uint32
+}
+
+// assemble assembles the given source, resolving names not labeled within it via the given function.
+// Labels are determined in a first pass, so that branches may reference those following them.
+func assemble(source string, address uint32, resolve func(name string) (uint32, error)) ([]byte, Labels, error) {
+	defined := Labels{}
+	var statements []statement
+	current := address
+	for i, raw := range strings.Split(source, "\n") {
+		text := raw
+		for _, comment := range []string{"#", "//"} {
+			if index := strings.Index(text, comment); index != -1 {
+				text = text[:index]
+			}
+		}
+		text = strings.TrimSpace(text)
+
+		for {
+			match := labelPattern.FindStringSubmatch(text)
+			if match == nil {
+				break
+			}
+			if _, exists := defined[match[1]]; exists {
+				return nil, nil, &AssemblyError{i + 1, strings.TrimSpace(raw), fmt.Errorf("label \"%s\" is already defined", match[1])}
+			}
+
+			defined[match[1]] = current
+			text = strings.TrimSpace(text[len(match[0]):])
+		}
+		if text == "" {
+			continue
+		}
+
+		parsed := statement{line: i + 1, source: strings.TrimSpace(raw), text: text, address: current}
+		if fields := strings.Fields(text); strings.ToLower(fields[0]) == ".space" {
+			length, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(text, fields[0])), 0, 32)
+			if err != nil {
+				return nil, nil, &AssemblyError{parsed.line, parsed.source, errors.New("expected a length")}
+			}
+
+			parsed.space = uint32(length)
+			current += parsed.space
+		} else {
+			if current%4 != 0 {
+				return nil, nil, &AssemblyError{parsed.line, parsed.source, errors.New("instructions must be word-aligned")}
+			}
+			current += 4
+		}
+		statements = append(statements, parsed)
+	}
+
+	local := func(name string) (uint32, error) {
+		if labeled, ok := defined[name]; ok {
+			return labeled, nil
+		}
+
+		return resolve(name)
+	}
+
+	var contents []byte
+	for _, parsed := range statements {
+		if strings.ToLower(strings.Fields(parsed.text)[0]) == ".space" {
+			contents = append(contents, make([]byte, parsed.space)...)
+			continue
+		}
+
+		a := &assembler{parsed.address, local}
+		word, err := a.instruction(parsed.text)
+		if err != nil {
+			return nil, nil, &AssemblyError{parsed.line, parsed.source, err}
+		}
+
+		var instr [4]byte
+		binary.BigEndian.PutUint32(instr[:], word)
+		contents = append(contents, instr[:]...)
+	}
+
+	return contents, defined, nil
+}
+
+// instruction assembles a single instruction.
+func (a *assembler) instruction(line string) (uint32, error) {
+	line = strings.TrimSpace(line)
+	name, operands := line, ""
+	if space := strings.IndexAny(line, " \t"); space != -1 {
+		name, operands = line[:space], strings.TrimSpace(line[space:])
+	}
+	name = strings.ToLower(name)
+
+	var ops []string
+	if operands != "" {
+		for _, op := range strings.Split(operands, ",") {
+			ops = append(ops, strings.TrimSpace(op))
+		}
+	}
+
+	if found, ok := mnemonics[name]; ok {
+		return found.encode(a, ops)
+	}
+
+	// Suffixes are only permitted upon instructions supporting them.
+	var suffixBits uint32
+	base := name
+	if strings.HasSuffix(base, ".") {
+		base = strings.TrimSuffix(base, ".")
+		suffixBits |= 1
+	}
+	found, ok := mnemonics[base]
+	if ok && (suffixBits == 0 || found.record) {
+		word, err := found.encode(a, ops)
+		return word | suffixBits, err
+	}
+
+	if strings.HasSuffix(base, "o") {
+		found, ok = mnemonics[strings.TrimSuffix(base, "o")]
+		if ok && found.overflow {
+			word, err := found.encode(a, ops)
+			return word | suffixBits | 1<<10, err
+		}
+	}
+
+	return 0, fmt.Errorf("unknown instruction \"%s\"", name)
+}
+
+// expect ensures the given amount of operands are present.
+func expect(ops []string, count int) error {
+	if len(ops) != count {
+		return fmt.Errorf("expected %d operands, but %d were given", count, len(ops))
+	}
+
+	return nil
+}
+
+// register parses a register with the given prefix, such as "r3" or "f1".
+func register(op string, prefix string) (uint32, error) {
+	op = strings.ToLower(op)
+	if prefix == "r" {
+		switch op {
+		case "sp":
+			return 1, nil
+		case "rtoc":
+			return 2, nil
+		}
+	}
+
+	if strings.HasPrefix(op, prefix) {
+		value, err := strconv.ParseUint(op[len(prefix):], 10, 32)
+		if err == nil && value < 32 {
+			return uint32(value), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid register \"%s\"", op)
+}
+
+// gpr parses a general-purpose register.
+func gpr(op string) (uint32, error) {
+	return register(op, "r")
+}
+
+// fpr parses a floating-point register.
+func fpr(op string) (uint32, error) {
+	return register(op, "f")
+}
+
+// parseCRField parses a condition register field such as "cr1", returning its index.
+func parseCRField(op string) (uint32, error) {
+	field, err := register(op, "cr")
+	if err != nil || field > 7 {
+		return 0, fmt.Errorf("invalid condition register field \"%s\"", op)
+	}
+
+	return field, nil
+}
+
+// value parses a numeric operand, which may reference a symbol.
+// A suffix of "@h", "@ha" or "@l" selects the upper, adjusted upper, or signed lower half of the value,
+// as is utilized to load addresses via lis followed by addi or ori.
+func (a *assembler) value(op string) (int64, error) {
+	base, modifier := op, ""
+	if at := strings.LastIndex(op, "@"); at > 0 {
+		switch op[at+1:] {
+		case "h", "ha", "l":
+			base, modifier = op[:at], op[at+1:]
+		}
+	}
+
+	parsed, err := strconv.ParseInt(base, 0, 64)
+	if err != nil {
+		if base == "" || (base[0] >= '0' && base[0] <= '9') || base[0] == '-' {
+			return 0, fmt.Errorf("invalid value \"%s\"", op)
+		}
+
+		address, err := a.resolve(base)
+		if err != nil {
+			return 0, err
+		}
+		parsed = int64(address)
+	}
+
+	switch modifier {
+	case "h":
+		return int64(uint32(parsed) >> 16), nil
+	case "ha":
+		return int64((uint32(parsed) + 0x8000) >> 16), nil
+	case "l":
+		return int64(int16(parsed)), nil
+	}
+
+	return parsed, nil
+}
+
+// immediate parses a 16-bit immediate. Both signed and unsigned values are permitted.
+func (a *assembler) immediate(op string) (uint32, error) {
+	value, err := a.value(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if value < -0x8000 || value > 0xffff {
+		return 0, fmt.Errorf("immediate \"%s\" does not fit within 16 bits", op)
+	}
+
+	return uint32(value) & 0xffff, nil
+}
+
+// field parses an unsigned value below the given limit, such as a shift or bit index.
+func (a *assembler) field(op string, limit int64) (uint32, error) {
+	value, err := a.value(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if value < 0 || value >= limit {
+		return 0, fmt.Errorf("value \"%s\" must be below %d", op, limit)
+	}
+
+	return uint32(value), nil
+}
+
+// displacement parses a displaced operand such as "-0x8(r1)", returning its displacement and base register.
+// The displacement must fit within the given amount of bits.
+func (a *assembler) displacement(op string, bits uint) (uint32, uint32, error) {
+	open := strings.LastIndex(op, "(")
+	if open == -1 || !strings.HasSuffix(op, ")") {
+		return 0, 0, fmt.Errorf("invalid displacement \"%s\", expected the form \"offset(rA)\"", op)
+	}
+
+	base, err := gpr(strings.TrimSpace(op[open+1 : len(op)-1]))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offset := int64(0)
+	if text := strings.TrimSpace(op[:open]); text != "" {
+		offset, err = a.value(text)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	limit := int64(1) << (bits - 1)
+	if offset < -limit || offset >= limit {
+		return 0, 0, fmt.Errorf("displacement \"%s\" does not fit within %d bits", op, bits)
+	}
+
+	return uint32(offset) & uint32(limit*2-1), base, nil
+}
+
+// branchDisplacement parses a branch target, returning the displacement to encode:
+// either relative to our address, or the target itself if absolute.
+// The displacement must be word-aligned and fit within the given amount of bits.
+func (a *assembler) branchDisplacement(op string, bits uint, absolute bool) (uint32, error) {
+	target, err := a.value(op)
+	if err != nil {
+		return 0, err
+	}
+
+	displacement := target
+	if !absolute {
+		displacement = int64(int32(uint32(target) - a.address))
+	} else if target > 0x7fffffff {
+		displacement = int64(int32(uint32(target)))
+	}
+
+	limit := int64(1) << (bits - 1)
+	if displacement%4 != 0 {
+		return 0, fmt.Errorf("branch target \"%s\" is not word-aligned", op)
+	}
+	if displacement < -limit || displacement >= limit {
+		return 0, fmt.Errorf("branch target \"%s\" is out of range", op)
+	}
+
+	return uint32(displacement) & uint32(limit*2-1), nil
+}
+
+// splitCRField separates an optional leading condition register field from the given operands.
+func splitCRField(ops []string, remaining int) (uint32, []string, error) {
+	if len(ops) == remaining+1 {
+		field, err := parseCRField(ops[0])
+		return field, ops[1:], err
+	}
+
+	return 0, ops, expect(ops, remaining)
+}
+
+// special parses a special-purpose register by name or number, returning it as encoded within mfspr and mtspr.
+func special(op string) (uint32, error) {
+	spr := uint32(0)
+	found := false
+	for number, name := range sprNames {
+		if name == strings.ToLower(op) {
+			spr, found = number, true
+			break
+		}
+	}
+
+	if !found {
+		parsed, err := strconv.ParseUint(op, 0, 10)
+		if err != nil {
+			return 0, fmt.Errorf("unknown special-purpose register \"%s\"", op)
+		}
+		spr = uint32(parsed)
+	}
+
+	// The halves of its number are swapped when encoded.
+	return (spr&0x1f)<<16 | (spr>>5)<<11, nil
+}
+
+// dForm encodes an instruction with a register, base register and 16-bit immediate.
+func dForm(opcode, d, a, immediate uint32) uint32 {
+	return opcode<<26 | d<<21 | a<<16 | immediate&0xffff
+}
+
+// xForm encodes an instruction with three register fields and an extended opcode.
+func xForm(opcode, d, a, b, xo uint32) uint32 {
+	return opcode<<26 | d<<21 | a<<16 | b<<11 | xo<<1
+}
+
+// registers parses operands as registers with the given prefixes.
+func registers(ops []string, prefixes ...string) ([]uint32, error) {
+	if err := expect(ops, len(prefixes)); err != nil {
+		return nil, err
+	}
+
+	parsed := make([]uint32, len(ops))
+	for i, op := range ops {
+		var err error
+		parsed[i], err = register(op, prefixes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parsed, nil
+}
+
+// arithmeticImmediate encodes "op rD, rA, SIMM".
+func arithmeticImmediate(opcode uint32) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		immediate, err := a.immediate(ops[2])
+		return dForm(opcode, regs[0], regs[1], immediate), err
+	}}
+}
+
+// logicalImmediate encodes "op rA, rS, UIMM", where the source register is encoded first.
+func logicalImmediate(opcode uint32) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		immediate, err := a.immediate(ops[2])
+		return dForm(opcode, regs[1], regs[0], immediate), err
+	}}
+}
+
+// loadStore encodes "op rD, d(rA)", or "op fD, d(rA)" for floating-point loads and stores.
+func loadStore(opcode uint32, prefix string) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 2); err != nil {
+			return 0, err
+		}
+		d, err := register(ops[0], prefix)
+		if err != nil {
+			return 0, err
+		}
+		offset, base, err := a.displacement(ops[1], 16)
+		return dForm(opcode, d, base, offset), err
+	}}
+}
+
+// compareImmediate encodes "op [crfD,] rA, IMM".
+func compareImmediate(opcode uint32) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		field, ops, err := splitCRField(ops, 2)
+		if err != nil {
+			return 0, err
+		}
+		rA, err := gpr(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		immediate, err := a.immediate(ops[1])
+		return dForm(opcode, field<<2, rA, immediate), err
+	}}
+}
+
+// compareRegisters encodes "op [crfD,] rA, rB" with the given prefix.
+func compareRegisters(opcode, xo uint32, prefix string) mnemonic {
+	return mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		field, ops, err := splitCRField(ops, 2)
+		if err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops, prefix, prefix)
+		if err != nil {
+			return 0, err
+		}
+		return xForm(opcode, field<<2, regs[0], regs[1], xo), nil
+	}}
+}
+
+// fixed encodes an instruction without operands.
+func fixed(word uint32) mnemonic {
+	return mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		return word, expect(ops, 0)
+	}}
+}
+
+// branch encodes "b target" with the given link and absolute bits.
+func branch(link, absolute bool) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 1); err != nil {
+			return 0, err
+		}
+		displacement, err := a.branchDisplacement(ops[0], 26, absolute)
+		return 18<<26 | displacement | branchBits(link, absolute), err
+	}}
+}
+
+// conditionalBranch encodes a conditional branch with the given BO and condition bit,
+// accepting an optional condition register field before its target.
+func conditionalBranch(bo, bit uint32, link, absolute bool) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		field := uint32(0)
+		var err error
+		if bo&0x10 == 0 {
+			field, ops, err = splitCRField(ops, 1)
+		} else {
+			err = expect(ops, 1)
+		}
+		if err != nil {
+			return 0, err
+		}
+		displacement, err := a.branchDisplacement(ops[0], 16, absolute)
+		return 16<<26 | bo<<21 | (field*4+bit)<<16 | displacement | branchBits(link, absolute), err
+	}}
+}
+
+// registerBranch encodes a branch to the link or count register with the given BO and condition bit,
+// accepting an optional condition register field.
+func registerBranch(xo, bo, bit uint32, link bool) mnemonic {
+	return mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		field := uint32(0)
+		if len(ops) != 0 && bo&0x10 == 0 {
+			var err error
+			field, ops, err = splitCRField(ops, 0)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if err := expect(ops, 0); err != nil {
+			return 0, err
+		}
+		return xForm(19, bo, field*4+bit, 0, xo) | branchBits(link, false), nil
+	}}
+}
+
+// branchBits returns the link and absolute bits of a branch.
+func branchBits(link, absolute bool) uint32 {
+	bits := uint32(0)
+	if link {
+		bits |= 1
+	}
+	if absolute {
+		bits |= 2
+	}
+
+	return bits
+}
+
+// branchForms registers a branch mnemonic alongside its link and absolute forms.
+func branchForms(m map[string]mnemonic, name string, create func(link, absolute bool) mnemonic) {
+	m[name] = create(false, false)
+	m[name+"l"] = create(true, false)
+	m[name+"a"] = create(false, true)
+	m[name+"la"] = create(true, true)
+}
+
+// conditionRegisterLogic encodes "op crbD, crbA, crbB".
+func conditionRegisterLogic(xo uint32) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		var bits [3]uint32
+		for i, op := range ops {
+			var err error
+			bits[i], err = a.field(op, 32)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return xForm(19, bits[0], bits[1], bits[2], xo), nil
+	}}
+}
+
+// rotate encodes "op rA, rS, SH, MB, ME", or with a register shift if requested.
+func rotate(opcode uint32, registerShift bool) mnemonic {
+	return mnemonic{record: true, encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 5); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+
+		var shift uint32
+		if registerShift {
+			shift, err = gpr(ops[2])
+		} else {
+			shift, err = a.field(ops[2], 32)
+		}
+		if err != nil {
+			return 0, err
+		}
+		begin, err := a.field(ops[3], 32)
+		if err != nil {
+			return 0, err
+		}
+		end, err := a.field(ops[4], 32)
+		return opcode<<26 | regs[1]<<21 | regs[0]<<16 | shift<<11 | begin<<6 | end<<1, err
+	}}
+}
+
+// rotateAlias encodes a simplified rotate "op rA, rS, n", given how n maps to SH, MB and ME.
+func rotateAlias(fields func(n uint32) (uint32, uint32, uint32)) mnemonic {
+	return mnemonic{record: true, encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		n, err := a.field(ops[2], 32)
+		if err != nil {
+			return 0, err
+		}
+		shift, begin, end := fields(n)
+		return 21<<26 | regs[1]<<21 | regs[0]<<16 | (shift&0x1f)<<11 | begin<<6 | end<<1, nil
+	}}
+}
+
+// arithmetic encodes "op rD, rA, rB", or "op rD, rA" for those with a single source.
+func arithmetic(xo uint32, sources int) mnemonic {
+	prefixes := []string{"r", "r", "r"}[:sources+1]
+	return mnemonic{record: true, overflow: true, encode: func(_ *assembler, ops []string) (uint32, error) {
+		regs, err := registers(ops, prefixes...)
+		if err != nil {
+			return 0, err
+		}
+		regs = append(regs, 0)
+		return xForm(31, regs[0], regs[1], regs[2], xo), nil
+	}}
+}
+
+// logical encodes "op rA, rS, rB", or "op rA, rS" for those with a single source,
+// where the source register is encoded first.
+func logical(xo uint32, sources int) mnemonic {
+	prefixes := []string{"r", "r", "r"}[:sources+1]
+	return mnemonic{record: true, encode: func(_ *assembler, ops []string) (uint32, error) {
+		regs, err := registers(ops, prefixes...)
+		if err != nil {
+			return 0, err
+		}
+		regs = append(regs, 0)
+		return xForm(31, regs[1], regs[0], regs[2], xo), nil
+	}}
+}
+
+// indexed encodes "op rD, rA, rB" without a record form, such as indexed loads and stores.
+func indexed(xo uint32, count int) mnemonic {
+	prefixes := []string{"r", "r", "r"}[3-count:]
+	return mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		regs, err := registers(ops, prefixes...)
+		if err != nil {
+			return 0, err
+		}
+		// Cache management instructions lack a destination.
+		regs = append(make([]uint32, 3-count), regs...)
+		return xForm(31, regs[0], regs[1], regs[2], xo), nil
+	}}
+}
+
+// moveRegister encodes "op rD" for instructions accessing special registers,
+// given their extended opcode and encoded special-purpose register, if any.
+func moveRegister(xo uint32, spr uint32) mnemonic {
+	return mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		regs, err := registers(ops, "r")
+		if err != nil {
+			return 0, err
+		}
+		return xForm(31, regs[0], 0, 0, xo) | spr, nil
+	}}
+}
+
+// floatArithmetic encodes an A-form floating-point instruction given which of fA, fB and fC it accepts, in order.
+func floatArithmetic(opcode, xo uint32, order string) mnemonic {
+	return mnemonic{record: true, encode: func(_ *assembler, ops []string) (uint32, error) {
+		prefixes := make([]string, len(order)+1)
+		for i := range prefixes {
+			prefixes[i] = "f"
+		}
+		regs, err := registers(ops, prefixes...)
+		if err != nil {
+			return 0, err
+		}
+
+		word := opcode<<26 | regs[0]<<21 | xo<<1
+		for i, operand := range order {
+			shift := map[rune]uint32{'a': 16, 'b': 11, 'c': 6}[operand]
+			word |= regs[i+1] << shift
+		}
+		return word, nil
+	}}
+}
+
+// pairedSingle encodes "op fD, d(rA), W, qrI", whose displacement is only 12 bits.
+func pairedSingle(opcode uint32) mnemonic {
+	return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 4); err != nil {
+			return 0, err
+		}
+		fD, err := fpr(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		offset, base, err := a.displacement(ops[1], 12)
+		if err != nil {
+			return 0, err
+		}
+		w, err := a.field(ops[2], 2)
+		if err != nil {
+			return 0, err
+		}
+		qr, err := register(ops[3], "qr")
+		if err != nil || qr > 7 {
+			return 0, fmt.Errorf("invalid quantization register \"%s\"", ops[3])
+		}
+		return opcode<<26 | fD<<21 | base<<16 | w<<15 | qr<<12 | offset, nil
+	}}
+}
+
+// newMnemonics returns all instructions we are able to assemble.
+// Patches are assembled during package initialization, so this must not depend upon init functions.
+func newMnemonics() map[string]mnemonic {
+	m := map[string]mnemonic{}
+
+	// Immediate arithmetic, logic and comparisons.
+	m["mulli"] = arithmeticImmediate(7)
+	m["subfic"] = arithmeticImmediate(8)
+	m["addic"] = arithmeticImmediate(12)
+	m["addic."] = arithmeticImmediate(13)
+	m["addi"] = arithmeticImmediate(14)
+	m["addis"] = arithmeticImmediate(15)
+	m["cmplwi"] = compareImmediate(10)
+	m["cmpwi"] = compareImmediate(11)
+	m["ori"] = logicalImmediate(24)
+	m["oris"] = logicalImmediate(25)
+	m["xori"] = logicalImmediate(26)
+	m["xoris"] = logicalImmediate(27)
+	m["andi."] = logicalImmediate(28)
+	m["andis."] = logicalImmediate(29)
+	m["nop"] = fixed(0x60000000)
+
+	for _, load := range []struct {
+		name string
+		op   uint32
+	}{{"li", 14}, {"lis", 15}} {
+		opcode := load.op
+		m[load.name] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+			if err := expect(ops, 2); err != nil {
+				return 0, err
+			}
+			rD, err := gpr(ops[0])
+			if err != nil {
+				return 0, err
+			}
+			immediate, err := a.immediate(ops[1])
+			return dForm(opcode, rD, 0, immediate), err
+		}}
+	}
+	m["subi"] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		value, err := a.value(ops[2])
+		if err != nil {
+			return 0, err
+		}
+		if value < -0xffff || value > 0x8000 {
+			return 0, fmt.Errorf("immediate \"%s\" does not fit within 16 bits", ops[2])
+		}
+		return dForm(14, regs[0], regs[1], uint32(-value)), nil
+	}}
+
+	// Loads and stores.
+	for i, name := range []string{
+		"lwz", "lwzu", "lbz", "lbzu", "stw", "stwu", "stb", "stbu",
+		"lhz", "lhzu", "lha", "lhau", "sth", "sthu", "lmw", "stmw",
+	} {
+		m[name] = loadStore(32+uint32(i), "r")
+	}
+	for i, name := range []string{"lfs", "lfsu", "lfd", "lfdu", "stfs", "stfsu", "stfd", "stfdu"} {
+		m[name] = loadStore(48+uint32(i), "f")
+	}
+	for opcode, name := range map[uint32]string{56: "psq_l", 57: "psq_lu", 60: "psq_st", 61: "psq_stu"} {
+		m[name] = pairedSingle(opcode)
+	}
+
+	// Branches. Conditional branches are taken with BO 12 when their bit is set, and 4 when clear.
+	branchForms(m, "b", branch)
+	branchForms(m, "bc", func(link, absolute bool) mnemonic {
+		return mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+			if err := expect(ops, 3); err != nil {
+				return 0, err
+			}
+			bo, err := a.field(ops[0], 32)
+			if err != nil {
+				return 0, err
+			}
+			bi, err := a.field(ops[1], 32)
+			if err != nil {
+				return 0, err
+			}
+			return conditionalBranch(bo, bi, link, absolute).encode(a, ops[2:])
+		}}
+	})
+	for bit := uint32(0); bit < 4; bit++ {
+		for _, condition := range []struct {
+			name string
+			bo   uint32
+		}{{conditionTrue[bit], 12}, {conditionFalse[bit], 4}} {
+			bo, bit := condition.bo, bit
+			branchForms(m, "b"+condition.name, func(link, absolute bool) mnemonic {
+				return conditionalBranch(bo, bit, link, absolute)
+			})
+			m["b"+condition.name+"lr"] = registerBranch(16, bo, bit, false)
+			m["b"+condition.name+"lrl"] = registerBranch(16, bo, bit, true)
+			m["b"+condition.name+"ctr"] = registerBranch(528, bo, bit, false)
+			m["b"+condition.name+"ctrl"] = registerBranch(528, bo, bit, true)
+		}
+	}
+	for _, counter := range []struct {
+		name string
+		bo   uint32
+	}{{"bdnz", 16}, {"bdz", 18}} {
+		bo := counter.bo
+		branchForms(m, counter.name, func(link, absolute bool) mnemonic {
+			return conditionalBranch(bo, 0, link, absolute)
+		})
+		m[counter.name+"lr"] = registerBranch(16, bo, 0, false)
+		m[counter.name+"lrl"] = registerBranch(16, bo, 0, true)
+	}
+	m["blr"] = registerBranch(16, 20, 0, false)
+	m["blrl"] = registerBranch(16, 20, 0, true)
+	m["bctr"] = registerBranch(528, 20, 0, false)
+	m["bctrl"] = registerBranch(528, 20, 0, true)
+	for _, target := range []struct {
+		name string
+		xo   uint32
+	}{{"bclr", 16}, {"bcctr", 528}} {
+		xo := target.xo
+		for _, link := range []bool{false, true} {
+			link := link
+			name := target.name
+			if link {
+				name += "l"
+			}
+			m[name] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+				if err := expect(ops, 2); err != nil {
+					return 0, err
+				}
+				bo, err := a.field(ops[0], 32)
+				if err != nil {
+					return 0, err
+				}
+				bi, err := a.field(ops[1], 32)
+				return xForm(19, bo, bi, 0, xo) | branchBits(link, false), err
+			}}
+		}
+	}
+
+	// System and condition register instructions.
+	m["sc"] = fixed(0x44000002)
+	m["rfi"] = fixed(xForm(19, 0, 0, 0, 50))
+	m["isync"] = fixed(xForm(19, 0, 0, 0, 150))
+	m["sync"] = fixed(xForm(31, 0, 0, 0, 598))
+	m["eieio"] = fixed(xForm(31, 0, 0, 0, 854))
+	m["crnor"] = conditionRegisterLogic(33)
+	m["crxor"] = conditionRegisterLogic(193)
+	m["creqv"] = conditionRegisterLogic(289)
+	m["cror"] = conditionRegisterLogic(449)
+	for name, xo := range map[string]uint32{"crclr": 193, "crset": 289} {
+		xo := xo
+		m[name] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+			if err := expect(ops, 1); err != nil {
+				return 0, err
+			}
+			return conditionRegisterLogic(xo).encode(a, []string{ops[0], ops[0], ops[0]})
+		}}
+	}
+
+	// Rotates and their simplified forms.
+	m["rlwimi"] = rotate(20, false)
+	m["rlwinm"] = rotate(21, false)
+	m["rlwnm"] = rotate(23, true)
+	m["slwi"] = rotateAlias(func(n uint32) (uint32, uint32, uint32) { return n, 0, 31 - n })
+	m["srwi"] = rotateAlias(func(n uint32) (uint32, uint32, uint32) { return 32 - n, n, 31 })
+	m["clrlwi"] = rotateAlias(func(n uint32) (uint32, uint32, uint32) { return 0, n, 31 })
+	m["rotlwi"] = rotateAlias(func(n uint32) (uint32, uint32, uint32) { return n, 0, 31 })
+
+	// Register arithmetic and logic within opcode 31.
+	for xo, name := range map[uint32]string{
+		8: "subfc", 10: "addc", 40: "subf", 136: "subfe", 138: "adde",
+		235: "mullw", 266: "add", 459: "divwu", 491: "divw",
+	} {
+		m[name] = arithmetic(xo, 2)
+	}
+	for xo, name := range map[uint32]string{104: "neg", 200: "subfze", 202: "addze"} {
+		m[name] = arithmetic(xo, 1)
+	}
+	for xo, name := range map[uint32]string{
+		24: "slw", 28: "and", 60: "andc", 124: "nor", 284: "eqv", 316: "xor",
+		412: "orc", 444: "or", 476: "nand", 536: "srw", 792: "sraw",
+	} {
+		m[name] = logical(xo, 2)
+	}
+	for xo, name := range map[uint32]string{26: "cntlzw", 922: "extsh", 954: "extsb"} {
+		m[name] = logical(xo, 1)
+	}
+	for name, xo := range map[string]uint32{"mr": 444, "not": 124} {
+		xo := xo
+		m[name] = mnemonic{record: true, encode: func(_ *assembler, ops []string) (uint32, error) {
+			regs, err := registers(ops, "r", "r")
+			if err != nil {
+				return 0, err
+			}
+			return xForm(31, regs[1], regs[0], regs[1], xo), nil
+		}}
+	}
+	m["srawi"] = mnemonic{record: true, encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[:2], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		shift, err := a.field(ops[2], 32)
+		return xForm(31, regs[1], regs[0], shift, 824), err
+	}}
+	m["cmpw"] = compareRegisters(31, 0, "r")
+	m["cmplw"] = compareRegisters(31, 32, "r")
+	m["tw"] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 3); err != nil {
+			return 0, err
+		}
+		to, err := a.field(ops[0], 32)
+		if err != nil {
+			return 0, err
+		}
+		regs, err := registers(ops[1:], "r", "r")
+		if err != nil {
+			return 0, err
+		}
+		return xForm(31, to, regs[0], regs[1], 4), nil
+	}}
+	m["trap"] = fixed(xForm(31, 31, 0, 0, 4))
+
+	// Indexed loads and stores, and cache management.
+	for xo, name := range map[uint32]string{
+		20: "lwarx", 23: "lwzx", 55: "lwzux", 87: "lbzx", 119: "lbzux",
+		151: "stwx", 183: "stwux", 215: "stbx", 247: "stbux", 279: "lhzx", 343: "lhax",
+		407: "sthx", 534: "lwbrx", 662: "stwbrx", 790: "lhbrx", 918: "sthbrx",
+	} {
+		m[name] = indexed(xo, 3)
+	}
+	// stwcx. is only valid with its record bit set.
+	m["stwcx."] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		word, err := indexed(150, 3).encode(a, ops)
+		return word | 1, err
+	}}
+	for xo, name := range map[uint32]string{54: "dcbst", 86: "dcbf", 246: "dcbtst", 278: "dcbt", 470: "dcbi", 982: "icbi", 1014: "dcbz"} {
+		m[name] = indexed(xo, 2)
+	}
+
+	// Special registers.
+	m["mfcr"] = moveRegister(19, 0)
+	m["mfmsr"] = moveRegister(83, 0)
+	m["mtmsr"] = moveRegister(146, 0)
+	timeBase, _ := special("268")
+	m["mftb"] = moveRegister(371, timeBase)
+	for number, name := range map[uint32]string{1: "xer", 8: "lr", 9: "ctr"} {
+		spr, _ := special(fmt.Sprint(number))
+		m["mf"+name] = moveRegister(339, spr)
+		m["mt"+name] = moveRegister(467, spr)
+	}
+	m["mfspr"] = mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 2); err != nil {
+			return 0, err
+		}
+		rD, err := gpr(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		spr, err := special(ops[1])
+		return xForm(31, rD, 0, 0, 339) | spr, err
+	}}
+	m["mtspr"] = mnemonic{encode: func(_ *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 2); err != nil {
+			return 0, err
+		}
+		spr, err := special(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		rS, err := gpr(ops[1])
+		return xForm(31, rS, 0, 0, 467) | spr, err
+	}}
+	m["mtcrf"] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 2); err != nil {
+			return 0, err
+		}
+		mask, err := a.field(ops[0], 0x100)
+		if err != nil {
+			return 0, err
+		}
+		rS, err := gpr(ops[1])
+		return xForm(31, rS, 0, 0, 144) | mask<<12, err
+	}}
+
+	// Floating-point arithmetic, in both single and double precision.
+	for _, float := range []struct {
+		name  string
+		xo    uint32
+		order string
+	}{
+		{"fdiv", 18, "ab"}, {"fsub", 20, "ab"}, {"fadd", 21, "ab"},
+		{"fmul", 25, "ac"}, {"fmsub", 28, "acb"}, {"fmadd", 29, "acb"},
+	} {
+		m[float.name] = floatArithmetic(63, float.xo, float.order)
+		m[float.name+"s"] = floatArithmetic(59, float.xo, float.order)
+	}
+	for xo, name := range map[uint32]string{12: "frsp", 15: "fctiwz", 40: "fneg", 72: "fmr", 264: "fabs"} {
+		m[name] = floatArithmetic(63, xo, "b")
+	}
+	m["fcmpu"] = compareRegisters(63, 0, "f")
+	m["fcmpo"] = compareRegisters(63, 32, "f")
+
+	// Raw words are permitted for anything else.
+	m[".long"] = mnemonic{encode: func(a *assembler, ops []string) (uint32, error) {
+		if err := expect(ops, 1); err != nil {
+			return 0, err
+		}
+		value, err := a.value(ops[0])
+		if err != nil {
+			return 0, err
+		}
+		if value < -0x80000000 || value > 0xffffffff {
+			return 0, fmt.Errorf("value \"%s\" does not fit within 32 bits", ops[0])
+		}
+		return uint32(value), nil
+	}}
+
+	return m
+}
@@ -0,0 +1,256 @@
+package patcher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// testCustomCALength is the length of the root certificate our baseline custom CA patch was assembled for.
+const testCustomCALength = 900
+
+// TestAvailablePatchSetsMatchBaseline ensures patches assembled from source
+// are identical to the bytes they were previously written as.
+func TestAvailablePatchSetsMatchBaseline(t *testing.T) {
+	tests := []struct {
+		set    string
+		patch  string
+		before string
+		after  string
+	}{
+		{
+			set:   "overwrite_ios",
+			patch: "Clear extraneous functions",
+			before: "3c60802f38637ac44cc63182482a8b783c60802f38637ab84cc63182482a8b68" +
+				"386d80204cc63182482a8b5c000000004e800020000000000000000000000000" +
+				"4e8000200000000000000000000000004e800020000000000000000000000000" +
+				"4e800020000000000000000000000000",
+			after: "4e80002000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000000" +
+				"00000000000000000000000000000000",
+		},
+		{
+			set:    "overwrite_ios",
+			patch:  "Repair textinput::EventObserver vtable",
+			before: "800144508001444080014430800144208001441080014400800143f0",
+			after:  "800143f0800143f0800143f0800143f0800143f0800143f0800143f0",
+		},
+		{
+			set:    "overwrite_ios",
+			patch:  "Repair ipl::keyboard::EventObserver vtable",
+			before: "80014450800184e080014430800185208001874080018760800143f0",
+			after:  "800143f0800184e0800143f0800185208001874080018760800143f0",
+		},
+		{
+			set:   "overwrite_ios",
+			patch: "Insert patch table",
+			before: "0000000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000",
+			after: "cd8b420a0000000293a73ad420004770cd8005a00000cafe939f2100681ae008" +
+				"939f3240e008b000939f3564e00cb000930001ff",
+		},
+		{
+			set:   "overwrite_ios",
+			patch: "Insert overwriteIOSMemory",
+			before: "0000000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000000" +
+				"000000000000000000000000",
+			after: "3d008031610826e08128000081480004b1490000812800307d3e8ba681280008" +
+				"8148000c9149000081280010812900007c0004ac5529843e814800147c095000" +
+				"40820028812800188148001c9149000081280020814800249149000081280028" +
+				"8148002c914900004e800020",
+		},
+		{
+			set:    "overwrite_ios",
+			patch:  "Do not require input for exception handler",
+			before: "9421fc10",
+			after:  "4e800020",
+		},
+		{
+			set:    "overwrite_ios",
+			patch:  "Modify ipl::Exception::__ct",
+			before: "4e800020",
+			after:  "4280d294",
+		},
+		{
+			set:   "custom_ca",
+			patch: "Modify NHTTPi_SocSSLConnect to load cert",
+			before: "809c00c02c04000041820020807c00ac80bc00c4480159492c03000041820028" +
+				"3860fc14480000bc807c00ac809c00d848015a752c0300004182000c3860fc14" +
+				"480000a0",
+			after: "3c80802e608497b87ca52a7838a50384807c00ac480159492c03000041820028" +
+				"3860fc14480000bc600000006000000060000000600000006000000060000000" +
+				"60000000",
+		},
+		{
+			set:    "ec_title_check",
+			patch:  "Permit downloading all titles",
+			before: "9421ffe07c0802a6",
+			after:  "386000014e800020",
+		},
+		{
+			set:    "ec_title_check",
+			patch:  "Mark all titles as managed",
+			before: "9421fff07c0802a6",
+			after:  "386000014e800020",
+		},
+		{
+			set:    "ec_title_check",
+			patch:  "Mark all tickets as managed",
+			before: "9421fff07c0802a6",
+			after:  "386000014e800020",
+		},
+		{
+			set:    "ec_title_check",
+			patch:  "Nullify ec::removeAllTitles",
+			before: "9421ffc07c0802a6",
+			after:  "386000004e800020",
+		},
+	}
+
+	options := Options{RootCertificate: make([]byte, testCustomCALength)}
+	space := NewAllocator(FindVersion(21).FreeRegions)
+	sets := map[string]DOLPatchSet{}
+	for _, named := range AvailablePatchSets {
+		set, err := named.Set(options, space)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets[named.ID] = set
+	}
+
+	for _, test := range tests {
+		t.Run(test.patch, func(t *testing.T) {
+			var patch *DOLPatch
+			for i, current := range sets[test.set].Patches {
+				if current.Name == test.patch {
+					patch = &sets[test.set].Patches[i]
+				}
+			}
+			if patch == nil {
+				t.Fatalf("patch \"%s\" is not present within \"%s\"", test.patch, test.set)
+			}
+
+			for _, contents := range []struct {
+				name     string
+				actual   []byte
+				expected string
+			}{{"before", patch.Before, test.before}, {"after", patch.After, test.after}} {
+				expected, _ := hex.DecodeString(contents.expected)
+				if !bytes.Equal(contents.actual, expected) {
+					t.Errorf("%s bytes differ from the baseline:\n%x\n%x", contents.name, contents.actual, expected)
+				}
+			}
+		})
+	}
+}
+
+// TestAssembleDisassembleRoundTrip ensures instructions disassemble to the form they were written in,
+// or its canonical equivalent, and that the disassembly assembles to the same instruction.
+func TestAssembleDisassembleRoundTrip(t *testing.T) {
+	const address = 0x800acad0
+	tests := []struct {
+		source      string
+		disassembly string
+	}{
+		{"li r3, 1", "li r3, 0x1"},
+		{"li r3, -0x3ec", "li r3, -0x3ec"},
+		{"lis r4, 0x802e", "lis r4, 0x802e"},
+		{"addi r5, r5, 0x384", "addi r5, r5, 0x384"},
+		{"addis r3, r4, 0x10", "addis r3, r4, 0x10"},
+		{"ori r4, r4, 0x97b8", "ori r4, r4, 0x97b8"},
+		{"xor r5, r5, r5", "xor r5, r5, r5"},
+		{"or r3, r4, r4", "mr r3, r4"},
+		{"and. r3, r4, r5", "and. r3, r4, r5"},
+		{"subf r3, r4, r5", "subf r3, r4, r5"},
+		{"neg r3, r4", "neg r3, r4"},
+		{"srawi r3, r4, 2", "srawi r3, r4, 2"},
+		{"rlwinm r9, r9, 16, 16, 31", "rlwinm r9, r9, 16, 16, 31"},
+		{"rlwinm. r3, r4, 0, 0, 15", "rlwinm. r3, r4, 0, 0, 15"},
+		{"cmpwi r3, 0", "cmpwi r3, 0x0"},
+		{"cmpwi cr7, r3, -1", "cmpwi cr7, r3, -0x1"},
+		{"cmplw cr1, r3, r4", "cmplw cr1, r3, r4"},
+		{"lwz r3, 0xac(r28)", "lwz r3, 0xac(r28)"},
+		{"stwu r1, -0x20(r1)", "stwu r1, -0x20(r1)"},
+		{"lbz r3, 0(r4)", "lbz r3, 0x0(r4)"},
+		{"stmw r27, 0xc(r1)", "stmw r27, 0xc(r1)"},
+		{"lfs f1, 0x8(r3)", "lfs f1, 0x8(r3)"},
+		{"fadds f1, f2, f3", "fadds f1, f2, f3"},
+		{"mflr r0", "mflr r0"},
+		{"mtctr r12", "mtctr r12"},
+		{"mfspr r3, 0x3f0", "mfspr r3, hid0"},
+		{"sync", "sync"},
+		{"blr", "blr"},
+		{"bctrl", "bctrl"},
+		{"b 0x800acbb0", "b 0x800acbb0"},
+		{"bl 0x800c242c", "bl 0x800c242c"},
+		{"beq 0x800acaf8", "beq 0x800acaf8"},
+		{"bne cr7, 0x800acaf8", "bne cr7, 0x800acaf8"},
+		{"bdnz 0x800acaf8", "bdnz 0x800acaf8"},
+		// A conditional branch always taken must not be mistaken for b, as its displacement is far shorter.
+		{"bc 20, 0, 0x800a4d64", "bc 20, 0, 0x800a4d64"},
+		{"bcl 20, 31, 0x800acad4", "bcl 20, 31, 0x800acad4"},
+		{"nop", "nop"},
+		{"sc", "sc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			assembled, _, err := AssembleSource(test.source, address, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			disassembly := DisassembleBytes(assembled, address)
+			if len(disassembly) != 1 || disassembly[0] != test.disassembly {
+				t.Fatalf("disassembled as %q, expected \"%s\"", disassembly, test.disassembly)
+			}
+
+			reassembled, _, err := AssembleSource(disassembly[0], address, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reassembled, assembled) {
+				t.Fatalf("reassembled as %x, expected %x", reassembled, assembled)
+			}
+		})
+	}
+}
+
+// TestAvailablePatchSetsRoundTrip ensures the disassembly of every patch within a text section
+// assembles to the same bytes, so that inspecting patches shows exactly what they contain.
+func TestAvailablePatchSetsRoundTrip(t *testing.T) {
+	layout, err := ParseDOL(testDOL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := Options{RootCertificate: make([]byte, testCustomCALength)}
+	space := NewAllocator(FindVersion(21).FreeRegions)
+	for _, named := range AvailablePatchSets {
+		set, err := named.Set(options, space)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, patch := range set.Patches {
+			if section := layout.SectionAtAddress(patch.AtAddress); section == nil || !section.IsText {
+				continue
+			}
+
+			for _, contents := range [][]byte{patch.Before, patch.After} {
+				source := strings.Join(DisassembleBytes(contents, patch.AtAddress), "\n")
+				reassembled, _, err := AssembleSource(source, patch.AtAddress, nil, nil)
+				if err != nil {
+					t.Fatalf("patch \"%s\": %v", patch.Name, err)
+				}
+				if !bytes.Equal(reassembled, contents) {
+					t.Errorf("patch \"%s\" reassembled as %x, expected %x", patch.Name, reassembled, contents)
+				}
+			}
+		}
+	}
+}
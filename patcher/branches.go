@@ -0,0 +1,93 @@
+package patcher
+
+import (
+	"fmt"
+	"github.com/wii-tools/powerpc"
+)
+
+// CheckBranches ensures every branch within the replacement bytes of the given patch sets targets a declared label.
+// Each target is computed from the address its branch applies at, and must reside within a text section of the given main DOL,
+// must not lie within the middle of a different patch, and must be one of the DOLPatch.Labels of its patch.
+// The ranges are expected to be those computed from the given sets by PatchRanges.
+//
+// Only patches applying within a text section are checked, as data may coincidentally resemble a branch.
+// Code placed within a data section, such as an appended data section, is therefore not checked.
+func CheckBranches(declared []DOLPatchSet, ranges []PatchRange, dol []byte) error {
+	layout, err := ParseDOL(dol)
+	if err != nil {
+		return &InvalidWADError{err}
+	}
+
+	// Ranges refer to their patch by its index across all sets, beginning at 1.
+	var patches []DOLPatch
+	for _, set := range declared {
+		patches = append(patches, set.Patches...)
+	}
+
+	for _, current := range ranges {
+		section := layout.SectionAtOffset(current.Offset)
+		if section == nil || !section.IsText || current.patch > len(patches) {
+			continue
+		}
+
+		patch := patches[current.patch-1]
+		address, _ := layout.AddressOf(current.Offset)
+		for i := 0; i+4 <= len(patch.After); i += 4 {
+			var instr powerpc.Instruction
+			copy(instr[:], patch.After[i:i+4])
+
+			target, ok := branchTarget(instr, address+uint32(i))
+			if !ok {
+				continue
+			}
+
+			reason := branchTargetReason(target, current, patch.Labels, ranges, layout)
+			if reason != "" {
+				return &BranchError{current.SetName, current.PatchName, address + uint32(i), target, reason}
+			}
+		}
+	}
+
+	return nil
+}
+
+// branchTargetReason describes why the given target of a branch within the given range is invalid,
+// or returns an empty string if it is permitted.
+func branchTargetReason(target uint32, current PatchRange, labels Labels, ranges []PatchRange, layout *DOL) string {
+	section := layout.SectionAtAddress(target)
+	if section == nil || !section.IsText {
+		return "which is not within a text section"
+	}
+
+	// A branch may target its own patch or the beginning of another patch, even if
+	// either is placed within the middle of one it depends upon.
+	offset, _ := layout.OffsetOf(target)
+	var within *PatchRange
+	for i, other := range ranges {
+		if other.patch == current.patch {
+			if offset >= other.Offset && offset < other.Offset+other.Length {
+				within = nil
+				break
+			}
+			continue
+		}
+		if other.Offset == offset {
+			within = nil
+			break
+		}
+		if offset > other.Offset && offset < other.Offset+other.Length {
+			within = &ranges[i]
+		}
+	}
+	if within != nil {
+		return fmt.Sprintf("which is within the middle of patch \"%s\" from \"%s\"", within.PatchName, within.SetName)
+	}
+
+	for _, address := range labels {
+		if address == target {
+			return ""
+		}
+	}
+
+	return "which is not a declared label"
+}
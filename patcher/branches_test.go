@@ -0,0 +1,66 @@
+package patcher
+
+import (
+	"testing"
+)
+
+func TestCheckBranches(t *testing.T) {
+	dol := testDOL(t)
+	version := FindVersion(21)
+
+	tests := []struct {
+		name   string
+		source string
+		labels Labels
+		reason string
+	}{
+		{"declared label", "b TARGET", Labels{"TARGET": 0x80004100}, ""},
+		{"undeclared label", "bl 0x80004100", nil, "which is not a declared label"},
+		{"outside text", "b 0x80300000", nil, "which is not within a text section"},
+		{
+			"middle of another patch", "b 0x800143f4", nil,
+			"which is within the middle of patch \"Clear extraneous functions\" from \"Overwrite IOS Syscall for ES\"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			after, labels := MustAssembleLabeled(test.source, 0x800171e0, test.labels)
+			sets := []DOLPatchSet{
+				{Name: "Overwrite IOS Syscall for ES", Patches: []DOLPatch{{
+					Name:      "Clear extraneous functions",
+					AtAddress: 0x800143f0,
+					Before:    []byte{0x3c, 0x60, 0x80, 0x2f, 0x38, 0x63, 0x7a, 0xc4},
+					After:     make([]byte, 8),
+				}}},
+				{Name: "Test", Patches: []DOLPatch{{
+					Name:      "Branch",
+					AtAddress: 0x800171e0,
+					Before:    []byte{0x94, 0x21, 0xfc, 0x10},
+					After:     after,
+					Labels:    labels,
+				}}},
+			}
+
+			relocated, err := version.Relocate(sets, dol, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = CheckBranches(sets, PatchRanges(sets, relocated, dol), dol)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			branchErr, ok := err.(*BranchError)
+			if !ok {
+				t.Fatalf("expected a BranchError, but received %v", err)
+			}
+			if branchErr.PatchName != "Branch" || branchErr.Reason != test.reason {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
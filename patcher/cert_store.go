@@ -0,0 +1,126 @@
+package patcher
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+)
+
+// yearIssueTime returns an issuance of this year's date on January 1 at midnight.
+// It is determined upon issuance, as long-running processes may span years.
+func yearIssueTime() time.Time {
+	return time.Date(time.Now().Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// generateSerial generates a random serial number for our issued certificates.
+// It is taken from golang std: src/crypto/tls/generate_cert.go
+// Direct permalink on GitHub: https://git.io/JyyDw
+func generateSerial() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, serialNumberLimit)
+}
+
+// Certificates holds a root CA and wildcard server certificate issued by CreateCertificates.
+type Certificates struct {
+	// RootCertificate is the root CA in DER form, as patched into the main DOL.
+	RootCertificate []byte
+
+	// RootCertificatePEM and RootKeyPEM are the root CA and its private key in PEM form.
+	RootCertificatePEM []byte
+	RootKeyPEM         []byte
+
+	// ServerCertificatePEM and ServerKeyPEM are the server certificate and its private key in PEM form,
+	// suitable for usage with nginx or similar servers.
+	ServerCertificatePEM []byte
+	ServerKeyPEM         []byte
+}
+
+// CreateCertificates issues a root CA and wildcard server certificate for the given base domain.
+func CreateCertificates(baseDomain string) (*Certificates, error) {
+	////////////////////////////////////
+	//        Generate root CA        //
+	////////////////////////////////////
+	issueTime := yearIssueTime()
+	rootSerial, err := generateSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	rootCert := &x509.Certificate{
+		SignatureAlgorithm: x509.SHA1WithRSA,
+		SerialNumber:       rootSerial,
+		Subject: pkix.Name{
+			CommonName: "Open Shop Channel CA",
+		},
+		NotBefore:             issueTime,
+		NotAfter:              issueTime.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	rootPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPublic, err := x509.CreateCertificate(rand.Reader, rootCert, rootCert, &rootPriv.PublicKey, rootPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	////////////////////////////////////
+	//  Issue server TLS certificate  //
+	////////////////////////////////////
+	// We'll issue a wildcard for our CN and SANs.
+	// Is this recommended? Absolutely not, but who's to stop us?
+	issueName := "*." + baseDomain
+	serverSerial, err := generateSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert := x509.Certificate{
+		SignatureAlgorithm: x509.SHA1WithRSA,
+		SerialNumber:       serverSerial,
+		Subject: pkix.Name{
+			CommonName: issueName,
+		},
+		DNSNames: []string{
+			issueName,
+		},
+		NotBefore:             issueTime,
+		NotAfter:              issueTime.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageKeyAgreement | x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+
+	serverPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	serverPublic, err := x509.CreateCertificate(rand.Reader, &serverCert, rootCert, &serverPriv.PublicKey, rootPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificates{
+		RootCertificate:      rootPublic,
+		RootCertificatePEM:   pemEncode("CERTIFICATE", rootPublic),
+		RootKeyPEM:           pemEncode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rootPriv)),
+		ServerCertificatePEM: pemEncode("CERTIFICATE", serverPublic),
+		ServerKeyPEM:         pemEncode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(serverPriv)),
+	}, nil
+}
+
+func pemEncode(typeName string, bytes []byte) []byte {
+	block := pem.Block{Type: typeName, Bytes: bytes}
+	return pem.EncodeToMemory(&block)
+}
@@ -0,0 +1,142 @@
+package patcher
+
+import (
+	"github.com/wii-tools/powerpc"
+)
+
+// PatchRange describes bytes written by a patch within the main DOL.
+type PatchRange struct {
+	// SetName is the name of the patch set containing this patch.
+	SetName string
+
+	// PatchName is the name of the patch writing this range.
+	PatchName string
+
+	// Offset is the file offset this range begins at.
+	Offset int
+
+	// Length is the amount of bytes written.
+	Length int
+
+	// DependsOn names patches this patch relies upon, as declared by its DOLPatch.
+	DependsOn []string
+
+	// patch is the index of this range's patch across all sets, as names need not be unique.
+	patch int
+}
+
+// overlaps returns whether this range overlaps the given range.
+func (r PatchRange) overlaps(other PatchRange) bool {
+	return r.Offset < other.Offset+other.Length && other.Offset < r.Offset+r.Length
+}
+
+// dependsOn returns whether this range's patch declares a dependency upon the given patch.
+func (r PatchRange) dependsOn(name string) bool {
+	for _, dependency := range r.DependsOn {
+		if dependency == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PatchRanges returns all ranges written by the given patch sets within the given main DOL, in order of application.
+// The sets are expected to be those relocated from the given DOL patch sets by ShopVersion.Relocate.
+// Patches are applied to a copy of the DOL as ranges are computed, so that patches located by searching
+// reflect the bytes present upon their application. The given DOL is not modified.
+func PatchRanges(declared []DOLPatchSet, relocated []powerpc.PatchSet, dol []byte) []PatchRange {
+	scratch := append([]byte{}, dol...)
+
+	var ranges []PatchRange
+	index := 0
+	for i, set := range relocated {
+		for j, patch := range set.Patches {
+			index++
+			if len(patch.After) == 0 {
+				continue
+			}
+
+			var dependencies []string
+			if i < len(declared) && j < len(declared[i].Patches) {
+				dependencies = declared[i].Patches[j].DependsOn
+			}
+
+			offsets := []int{patch.AtOffset}
+			if patch.AtOffset == 0 {
+				// Patches failing to locate are reported upon application.
+				offsets, _ = LocatePatch(patch, scratch)
+			}
+
+			for _, offset := range offsets {
+				if offset+len(patch.After) <= len(scratch) {
+					copy(scratch[offset:], patch.After)
+				}
+
+				ranges = append(ranges, PatchRange{
+					SetName:   set.Name,
+					PatchName: patch.Name,
+					Offset:    offset,
+					Length:    len(patch.After),
+					DependsOn: dependencies,
+					patch:     index,
+				})
+			}
+		}
+	}
+
+	return ranges
+}
+
+// CheckConflicts ensures no patches within the given sets conflict prior to applying any.
+// Patches must be applied after all patches they depend upon, and may only overlap
+// bytes written by an earlier patch they depend upon. Dependencies must name a patch within the given sets
+// or an available patch set; those not selected or individually disabled are not required.
+// The ranges are expected to be those computed from the given sets by PatchRanges.
+func CheckConflicts(declared []DOLPatchSet, ranges []PatchRange) error {
+	// Determine the order patches are applied in.
+	order := map[string]int{}
+	index := 0
+	for _, set := range declared {
+		for _, patch := range set.Patches {
+			if _, present := order[patch.Name]; !present {
+				order[patch.Name] = index
+			}
+			index++
+		}
+	}
+
+	index = 0
+	for _, set := range declared {
+		for _, patch := range set.Patches {
+			for _, dependency := range patch.DependsOn {
+				applied, present := order[dependency]
+				if !present && !PatchExists(dependency) {
+					return &UnknownDependencyError{set.Name, patch.Name, dependency}
+				}
+				if present && applied > index {
+					return &DependencyOrderError{set.Name, patch.Name, dependency}
+				}
+			}
+			index++
+		}
+	}
+
+	for later := range ranges {
+		for earlier := 0; earlier < later; earlier++ {
+			first, second := ranges[earlier], ranges[later]
+			if first.patch == second.patch || !first.overlaps(second) || second.dependsOn(first.PatchName) {
+				continue
+			}
+
+			offset := second.Offset
+			if first.Offset > offset {
+				offset = first.Offset
+			}
+
+			return &OverlapError{second.SetName, second.PatchName, first.SetName, first.PatchName, offset}
+		}
+	}
+
+	return nil
+}
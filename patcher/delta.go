@@ -0,0 +1,343 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/wii-tools/wadlib"
+	"io"
+)
+
+const (
+	// deltaMagic begins every serialized delta.
+	deltaMagic = "WSCD"
+
+	// deltaVersion is the revision of our serialized format.
+	deltaVersion = 1
+
+	// deltaBlockSize is the length of blocks within original contents indexed when creating a delta.
+	deltaBlockSize = 16
+
+	// deltaMinimumCopy is the shortest match copied from original contents, rather than inserted.
+	// Copies shorter than this are larger than inserting their bytes.
+	deltaMinimumCopy = 12
+)
+
+var ErrInvalidDelta = errors.New("the delta is malformed or not of a supported version")
+
+// Delta describes how to reconstruct a patched WAD from its original contents.
+// Only modified contents are present, keyed by the hash of their original form,
+// so that it may be distributed without any of the original title.
+type Delta struct {
+	// TitleVersion is the version of the Wii Shop Channel this delta applies to.
+	TitleVersion uint16
+
+	// AccessRights is the TMD's access rights flags after patching.
+	AccessRights uint32
+
+	// PatchedHash is the SHA-256 hash of the patched WAD.
+	PatchedHash [sha256.Size]byte
+
+	// Contents lists all modified contents.
+	Contents []ContentDelta
+}
+
+// ContentDelta describes how to reconstruct a single patched content.
+type ContentDelta struct {
+	// Index is the index of this content within the TMD.
+	Index uint16
+
+	// OriginalHash and PatchedHash are the SHA-1 hashes of this content before and after patching.
+	OriginalHash [sha1.Size]byte
+	PatchedHash  [sha1.Size]byte
+
+	// Operations reconstruct the patched content, in order.
+	Operations []DeltaOperation
+}
+
+// DeltaOperation appends to a reconstructed content.
+type DeltaOperation struct {
+	// Data is appended if present. Otherwise, Length bytes are copied from Offset within the original content.
+	Data []byte
+
+	Offset uint32
+	Length uint32
+}
+
+// CreateDelta returns a delta reconstructing the given patched WAD from the given original WAD.
+func CreateDelta(original []byte, patched []byte) (*Delta, error) {
+	originalWad, err := LoadWAD(cloneBytes(original))
+	if err != nil {
+		return nil, err
+	}
+	patchedWad, err := LoadWAD(cloneBytes(patched))
+	if err != nil {
+		return nil, err
+	}
+
+	if originalWad.TMD.TitleVersion != patchedWad.TMD.TitleVersion || len(originalWad.TMD.Contents) != len(patchedWad.TMD.Contents) {
+		return nil, errors.New("the original and patched WADs are not of the same title")
+	}
+
+	delta := &Delta{
+		TitleVersion: patchedWad.TMD.TitleVersion,
+		AccessRights: patchedWad.TMD.AccessRightsFlags,
+		PatchedHash:  sha256.Sum256(patched),
+	}
+
+	for _, record := range patchedWad.TMD.Contents {
+		before, err := originalWad.GetContent(int(record.Index))
+		if err != nil {
+			return nil, &InvalidWADError{err}
+		}
+		after, err := patchedWad.GetContent(int(record.Index))
+		if err != nil {
+			return nil, &InvalidWADError{err}
+		}
+
+		if bytes.Equal(before, after) {
+			continue
+		}
+
+		delta.Contents = append(delta.Contents, ContentDelta{
+			Index:        record.Index,
+			OriginalHash: sha1.Sum(before),
+			PatchedHash:  sha1.Sum(after),
+			Operations:   diffContent(before, after),
+		})
+	}
+
+	return delta, nil
+}
+
+// diffContent returns operations reconstructing patched from original.
+// Matches at the same offset are preferred, as most patches modify bytes in place.
+// Otherwise, matches are found via blocks of the original content, permitting moved data to be copied.
+func diffContent(original []byte, patched []byte) []DeltaOperation {
+	blocks := map[string]int{}
+	for offset := 0; offset+deltaBlockSize <= len(original); offset += deltaBlockSize {
+		key := string(original[offset : offset+deltaBlockSize])
+		if _, present := blocks[key]; !present {
+			blocks[key] = offset
+		}
+	}
+
+	var operations []DeltaOperation
+	var pending []byte
+	for position := 0; position < len(patched); {
+		source, length := -1, 0
+		if position < len(original) {
+			source, length = position, matchLength(original[position:], patched[position:])
+		}
+		if length < deltaMinimumCopy && position+deltaBlockSize <= len(patched) {
+			if offset, ok := blocks[string(patched[position:position+deltaBlockSize])]; ok {
+				source, length = offset, matchLength(original[offset:], patched[position:])
+			}
+		}
+
+		if length < deltaMinimumCopy {
+			pending = append(pending, patched[position])
+			position++
+			continue
+		}
+
+		if len(pending) != 0 {
+			operations = append(operations, DeltaOperation{Data: pending})
+			pending = nil
+		}
+
+		// Contiguous copies are merged.
+		last := len(operations) - 1
+		if last >= 0 && operations[last].Data == nil && int(operations[last].Offset+operations[last].Length) == source {
+			operations[last].Length += uint32(length)
+		} else {
+			operations = append(operations, DeltaOperation{Offset: uint32(source), Length: uint32(length)})
+		}
+		position += length
+	}
+
+	if len(pending) != 0 {
+		operations = append(operations, DeltaOperation{Data: pending})
+	}
+
+	return operations
+}
+
+// matchLength returns the amount of leading bytes the given slices share.
+func matchLength(a []byte, b []byte) int {
+	length := 0
+	for length < len(a) && length < len(b) && a[length] == b[length] {
+		length++
+	}
+
+	return length
+}
+
+// Apply reconstructs the patched WAD from the given original WAD. The original's contents are verified
+// against those this delta was created from, and each reconstructed content against its patched form.
+// The reconstructed WAD is identical to the patched WAD if the original WAD is identical to that the delta
+// was created from; Matches reports whether this is so.
+func (d *Delta) Apply(original []byte) ([]byte, error) {
+	wad, err := LoadWAD(cloneBytes(original))
+	if err != nil {
+		return nil, err
+	}
+
+	if wad.TMD.TitleVersion != d.TitleVersion {
+		return nil, &UnsupportedTitleError{wad.TMD.TitleID, wad.TMD.TitleVersion}
+	}
+
+	for _, content := range d.Contents {
+		before, err := wad.GetContent(int(content.Index))
+		if err != nil {
+			return nil, &InvalidWADError{err}
+		}
+
+		if hash := sha1.Sum(before); hash != content.OriginalHash {
+			return nil, &DeltaMismatchError{content.Index, content.OriginalHash, hash, false}
+		}
+
+		var after []byte
+		for _, operation := range content.Operations {
+			if operation.Data != nil {
+				after = append(after, operation.Data...)
+				continue
+			}
+
+			end := uint64(operation.Offset) + uint64(operation.Length)
+			if end > uint64(len(before)) {
+				return nil, ErrInvalidDelta
+			}
+			after = append(after, before[operation.Offset:end]...)
+		}
+
+		if hash := sha1.Sum(after); hash != content.PatchedHash {
+			return nil, &DeltaMismatchError{content.Index, content.PatchedHash, hash, true}
+		}
+
+		err = wad.UpdateContent(int(content.Index), after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wad.TMD.AccessRightsFlags = d.AccessRights
+	return wad.GetWAD(wadlib.WADTypeCommon)
+}
+
+// Matches returns whether the given WAD is identical to the patched WAD this delta was created from.
+func (d *Delta) Matches(patched []byte) bool {
+	return sha256.Sum256(patched) == d.PatchedHash
+}
+
+// MarshalBinary serializes this delta.
+func (d *Delta) MarshalBinary() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(deltaMagic)
+
+	fields := []interface{}{
+		uint8(deltaVersion),
+		d.TitleVersion,
+		d.AccessRights,
+		d.PatchedHash,
+		uint16(len(d.Contents)),
+	}
+	for _, content := range d.Contents {
+		fields = append(fields, content.Index, content.OriginalHash, content.PatchedHash, uint32(len(content.Operations)))
+
+		for _, operation := range content.Operations {
+			if operation.Data != nil {
+				fields = append(fields, uint8(1), uint32(len(operation.Data)), operation.Data)
+			} else {
+				fields = append(fields, uint8(0), operation.Offset, operation.Length)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		err := binary.Write(&buffer, binary.BigEndian, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// ParseDelta parses a delta serialized by MarshalBinary.
+func ParseDelta(contents []byte) (*Delta, error) {
+	if !bytes.HasPrefix(contents, []byte(deltaMagic)) {
+		return nil, ErrInvalidDelta
+	}
+	reader := bytes.NewReader(contents[len(deltaMagic):])
+
+	var version uint8
+	var count uint16
+	delta := &Delta{}
+	err := readFields(reader, &version, &delta.TitleVersion, &delta.AccessRights, &delta.PatchedHash, &count)
+	if err != nil || version != deltaVersion {
+		return nil, ErrInvalidDelta
+	}
+
+	for i := 0; i < int(count); i++ {
+		var content ContentDelta
+		var operations uint32
+		err = readFields(reader, &content.Index, &content.OriginalHash, &content.PatchedHash, &operations)
+		if err != nil {
+			return nil, ErrInvalidDelta
+		}
+
+		for j := uint32(0); j < operations; j++ {
+			var kind uint8
+			var operation DeltaOperation
+			err = readFields(reader, &kind)
+			if err != nil {
+				return nil, ErrInvalidDelta
+			}
+
+			switch kind {
+			case 0:
+				err = readFields(reader, &operation.Offset, &operation.Length)
+			case 1:
+				var length uint32
+				err = readFields(reader, &length)
+				if err == nil && uint64(length) > uint64(reader.Len()) {
+					err = io.ErrUnexpectedEOF
+				}
+				if err == nil {
+					operation.Data = make([]byte, length)
+					_, err = io.ReadFull(reader, operation.Data)
+				}
+			default:
+				err = ErrInvalidDelta
+			}
+			if err != nil {
+				return nil, ErrInvalidDelta
+			}
+
+			content.Operations = append(content.Operations, operation)
+		}
+
+		delta.Contents = append(delta.Contents, content)
+	}
+
+	if reader.Len() != 0 {
+		return nil, ErrInvalidDelta
+	}
+
+	return delta, nil
+}
+
+// readFields reads all given fields from the reader, in big-endian order.
+func readFields(reader io.Reader, fields ...interface{}) error {
+	for _, field := range fields {
+		err := binary.Read(reader, binary.BigEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package patcher
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffContent(t *testing.T) {
+	original := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	tests := []struct {
+		name       string
+		patched    []byte
+		operations []DeltaOperation
+	}{
+		{"unmodified", original, []DeltaOperation{{Offset: 0, Length: 36}}},
+		{
+			"modified in place",
+			[]byte("0123456789abcdefXXijklmnopqrstuvwxyz"),
+			[]DeltaOperation{{Offset: 0, Length: 16}, {Data: []byte("XX")}, {Offset: 18, Length: 18}},
+		},
+		{
+			"moved",
+			[]byte("ghijklmnopqrstuvwxyz0123456789abcdef"),
+			[]DeltaOperation{{Offset: 16, Length: 20}, {Offset: 0, Length: 16}},
+		},
+		{"inserted", []byte("short"), []DeltaOperation{{Data: []byte("short")}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operations := diffContent(original, test.patched)
+			if !reflect.DeepEqual(operations, test.operations) {
+				t.Fatalf("unexpected operations %+v, expected %+v", operations, test.operations)
+			}
+		})
+	}
+}
+
+func TestDeltaApply(t *testing.T) {
+	original := testWAD(t, testDOL(t), testARC(t, []byte("[include]\r\n"), []byte{0, 0, 0x10, 0}))
+	p, err := New(Options{
+		BaseDomain:      "a.taur.cloud",
+		RootCertificate: testCertificate(t),
+		PatchSets:       DefaultPatchSets(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, _, err := p.Patch(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := CreateDelta(original, patched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := created.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := ParseDelta(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reconstructed, err := delta.Apply(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reconstructed, patched) || !delta.Matches(reconstructed) {
+		t.Fatal("applying the delta did not reconstruct the patched WAD")
+	}
+
+	// A differing original must be rejected, rather than reconstructing a different WAD.
+	modified := testDOL(t)
+	modified[0x1000] ^= 0xff
+	_, err = delta.Apply(testWAD(t, modified, testARC(t, []byte("[include]\r\n"), []byte{0, 0, 0x10, 0})))
+	if mismatch, ok := err.(*DeltaMismatchError); !ok || mismatch.Reconstructed {
+		t.Fatalf("expected a DeltaMismatchError for the original WAD, but received %v", err)
+	}
+}
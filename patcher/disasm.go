@@ -0,0 +1,446 @@
+package patcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wii-tools/powerpc"
+	"strings"
+)
+
+// hexImmediate formats a signed immediate in hexadecimal.
+func hexImmediate(value int32) string {
+	if value < 0 {
+		return fmt.Sprintf("-0x%x", -int64(value))
+	}
+
+	return fmt.Sprintf("0x%x", value)
+}
+
+// branchTarget returns the absolute target of the given branch instruction,
+// located at the given address. It returns false if the instruction is not a
+// relative or absolute branch - that is, neither b nor bc.
+func branchTarget(instr powerpc.Instruction, address uint32) (uint32, bool) {
+	word := binary.BigEndian.Uint32(instr[:])
+	absolute := (word>>1)&1 == 1
+
+	var displacement int32
+	switch word >> 26 {
+	case 18:
+		// Sign-extend our 26-bit displacement.
+		displacement = int32(word&0x03fffffc) << 6 >> 6
+	case 16:
+		displacement = int32(int16(word & 0xfffc))
+	default:
+		return 0, false
+	}
+
+	if absolute {
+		return uint32(displacement), true
+	}
+
+	return address + uint32(displacement), true
+}
+
+// branchCondition returns the simplified mnemonic and condition register operand
+// for a conditional branch with the given BO and BI fields.
+// It returns an empty mnemonic if there is no simplified form.
+func branchCondition(bo uint32, bi uint32) (string, string) {
+	cr := ""
+	if bi/4 != 0 {
+		cr = fmt.Sprintf("cr%d", bi/4)
+	}
+
+	switch {
+	case bo&0x14 == 0x14:
+		return "b", ""
+	case bo&0x1c == 0x0c:
+		return "b" + conditionTrue[bi%4], cr
+	case bo&0x1c == 0x04:
+		return "b" + conditionFalse[bi%4], cr
+	case bo&0x16 == 0x10:
+		return "bdnz", ""
+	case bo&0x16 == 0x12:
+		return "bdz", ""
+	default:
+		return "", ""
+	}
+}
+
+// Disassemble returns the mnemonic form of the given instruction, located at the given address.
+// Instructions we are unable to decode are represented as a .long directive.
+func Disassemble(instr powerpc.Instruction, address uint32) string {
+	word := binary.BigEndian.Uint32(instr[:])
+	opcode := word >> 26
+	rD := (word >> 21) & 0x1f
+	rA := (word >> 16) & 0x1f
+	rB := (word >> 11) & 0x1f
+	rC := (word >> 6) & 0x1f
+	simm := int32(int16(word & 0xffff))
+	uimm := word & 0xffff
+	record := ""
+	if word&1 == 1 {
+		record = "."
+	}
+
+	unknown := fmt.Sprintf(".long 0x%08x", word)
+
+	// Common operand formatting.
+	reg := func(r uint32) string { return fmt.Sprintf("r%d", r) }
+	freg := func(r uint32) string { return fmt.Sprintf("f%d", r) }
+	displaced := func(base uint32) string { return fmt.Sprintf("%s(%s)", hexImmediate(simm), reg(base)) }
+	operands := formatInstruction
+
+	switch opcode {
+	case 7:
+		return operands("mulli", reg(rD), reg(rA), hexImmediate(simm))
+	case 8:
+		return operands("subfic", reg(rD), reg(rA), hexImmediate(simm))
+	case 10:
+		return operands("cmplwi", crField(rD), reg(rA), fmt.Sprintf("0x%x", uimm))
+	case 11:
+		return operands("cmpwi", crField(rD), reg(rA), hexImmediate(simm))
+	case 12:
+		return operands("addic", reg(rD), reg(rA), hexImmediate(simm))
+	case 13:
+		return operands("addic.", reg(rD), reg(rA), hexImmediate(simm))
+	case 14:
+		if rA == 0 {
+			return operands("li", reg(rD), hexImmediate(simm))
+		}
+		return operands("addi", reg(rD), reg(rA), hexImmediate(simm))
+	case 15:
+		if rA == 0 {
+			return operands("lis", reg(rD), fmt.Sprintf("0x%x", uimm))
+		}
+		return operands("addis", reg(rD), reg(rA), fmt.Sprintf("0x%x", uimm))
+	case 16:
+		target, _ := branchTarget(instr, address)
+		mnemonic, cr := branchCondition(rD, rA)
+		// Unlike b, a conditional branch always taken is limited to a 16-bit displacement,
+		// so we show its real form rather than conflating the two.
+		if mnemonic == "" || mnemonic == "b" {
+			return operands("bc"+branchSuffix(word), fmt.Sprint(rD), fmt.Sprint(rA), fmt.Sprintf("0x%x", target))
+		}
+		return operands(mnemonic+branchSuffix(word), cr, fmt.Sprintf("0x%x", target))
+	case 17:
+		return "sc"
+	case 18:
+		target, _ := branchTarget(instr, address)
+		return operands("b"+branchSuffix(word), fmt.Sprintf("0x%x", target))
+	case 19:
+		return disassembleOpcode19(word)
+	case 20:
+		return operands("rlwimi"+record, reg(rA), reg(rD), fmt.Sprint(rB), fmt.Sprint(rC), fmt.Sprint((word>>1)&0x1f))
+	case 21:
+		return operands("rlwinm"+record, reg(rA), reg(rD), fmt.Sprint(rB), fmt.Sprint(rC), fmt.Sprint((word>>1)&0x1f))
+	case 23:
+		return operands("rlwnm"+record, reg(rA), reg(rD), reg(rB), fmt.Sprint(rC), fmt.Sprint((word>>1)&0x1f))
+	case 24:
+		if word == 0x60000000 {
+			return "nop"
+		}
+		return operands("ori", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 25:
+		return operands("oris", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 26:
+		return operands("xori", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 27:
+		return operands("xoris", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 28:
+		return operands("andi.", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 29:
+		return operands("andis.", reg(rA), reg(rD), fmt.Sprintf("0x%x", uimm))
+	case 31:
+		return disassembleOpcode31(word)
+	case 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47:
+		names := []string{
+			"lwz", "lwzu", "lbz", "lbzu", "stw", "stwu", "stb", "stbu",
+			"lhz", "lhzu", "lha", "lhau", "sth", "sthu", "lmw", "stmw",
+		}
+		return operands(names[opcode-32], reg(rD), displaced(rA))
+	case 48, 49, 50, 51, 52, 53, 54, 55:
+		names := []string{"lfs", "lfsu", "lfd", "lfdu", "stfs", "stfsu", "stfd", "stfdu"}
+		return operands(names[opcode-48], freg(rD), displaced(rA))
+	case 56, 57, 60, 61:
+		names := map[uint32]string{56: "psq_l", 57: "psq_lu", 60: "psq_st", 61: "psq_stu"}
+		// Paired single displacements are only 12 bits.
+		displacement := int32(word&0xfff) << 20 >> 20
+		return operands(names[opcode], freg(rD), fmt.Sprintf("%s(%s)", hexImmediate(displacement), reg(rA)),
+			fmt.Sprint((word>>15)&1), fmt.Sprintf("qr%d", (word>>12)&7))
+	case 59, 63:
+		return disassembleFloat(word)
+	}
+
+	return unknown
+}
+
+// formatInstruction formats a mnemonic and its operands, omitting empty operands.
+func formatInstruction(mnemonic string, ops ...string) string {
+	var present []string
+	for _, op := range ops {
+		if op != "" {
+			present = append(present, op)
+		}
+	}
+
+	if len(present) == 0 {
+		return mnemonic
+	}
+
+	return mnemonic + " " + strings.Join(present, ", ")
+}
+
+// crField formats a condition register field for comparisons, omitting cr0.
+func crField(crfD uint32) string {
+	if crfD>>2 == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("cr%d", crfD>>2)
+}
+
+// branchSuffix returns the suffix for a branch's link and absolute bits.
+func branchSuffix(word uint32) string {
+	suffix := ""
+	if word&1 == 1 {
+		suffix += "l"
+	}
+	if (word>>1)&1 == 1 {
+		suffix += "a"
+	}
+
+	return suffix
+}
+
+// disassembleOpcode19 handles branches to special registers and condition register logic.
+func disassembleOpcode19(word uint32) string {
+	bo := (word >> 21) & 0x1f
+	bi := (word >> 16) & 0x1f
+	crbB := (word >> 11) & 0x1f
+	link := ""
+	if word&1 == 1 {
+		link = "l"
+	}
+
+	switch (word >> 1) & 0x3ff {
+	case 16, 528:
+		register := "lr"
+		if (word>>1)&0x3ff == 528 {
+			register = "ctr"
+		}
+
+		mnemonic, cr := branchCondition(bo, bi)
+		if mnemonic == "" {
+			return fmt.Sprintf("bc%s%s %d, %d", register, link, bo, bi)
+		}
+		return formatInstruction(mnemonic+register+link, cr)
+	case 33:
+		return fmt.Sprintf("crnor %d, %d, %d", bo, bi, crbB)
+	case 50:
+		return "rfi"
+	case 150:
+		return "isync"
+	case 193:
+		return fmt.Sprintf("crxor %d, %d, %d", bo, bi, crbB)
+	case 289:
+		return fmt.Sprintf("creqv %d, %d, %d", bo, bi, crbB)
+	case 449:
+		return fmt.Sprintf("cror %d, %d, %d", bo, bi, crbB)
+	}
+
+	return fmt.Sprintf(".long 0x%08x", word)
+}
+
+// disassembleOpcode31 handles the many X-form and XO-form instructions sharing opcode 31.
+func disassembleOpcode31(word uint32) string {
+	rD := (word >> 21) & 0x1f
+	rA := (word >> 16) & 0x1f
+	rB := (word >> 11) & 0x1f
+	xo := (word >> 1) & 0x3ff
+	record := ""
+	if word&1 == 1 {
+		record = "."
+	}
+
+	// Arithmetic instructions have an overflow bit preceding a 9-bit extended opcode.
+	arithmetic := map[uint32]string{
+		8: "subfc", 10: "addc", 40: "subf", 104: "neg", 136: "subfe", 138: "adde",
+		200: "subfze", 202: "addze", 235: "mullw", 266: "add", 459: "divwu", 491: "divw",
+	}
+	if name, ok := arithmetic[xo&0x1ff]; ok {
+		if xo&0x200 != 0 {
+			name += "o"
+		}
+		if name == "neg" || name == "nego" || strings.HasSuffix(name, "ze") {
+			return fmt.Sprintf("%s%s r%d, r%d", name, record, rD, rA)
+		}
+		return fmt.Sprintf("%s%s r%d, r%d, r%d", name, record, rD, rA, rB)
+	}
+
+	// Logical instructions place their source register first.
+	logical := map[uint32]string{
+		24: "slw", 28: "and", 60: "andc", 124: "nor", 284: "eqv", 316: "xor",
+		412: "orc", 444: "or", 476: "nand", 536: "srw", 792: "sraw",
+	}
+	if name, ok := logical[xo]; ok {
+		if name == "or" && rD == rB {
+			return fmt.Sprintf("mr%s r%d, r%d", record, rA, rD)
+		}
+		return fmt.Sprintf("%s%s r%d, r%d, r%d", name, record, rA, rD, rB)
+	}
+
+	// Indexed loads and stores.
+	indexed := map[uint32]string{
+		20: "lwarx", 23: "lwzx", 55: "lwzux", 87: "lbzx", 119: "lbzux", 150: "stwcx.",
+		151: "stwx", 183: "stwux", 215: "stbx", 247: "stbux", 279: "lhzx", 343: "lhax",
+		407: "sthx", 534: "lwbrx", 662: "stwbrx", 790: "lhbrx", 918: "sthbrx",
+	}
+	if name, ok := indexed[xo]; ok {
+		return fmt.Sprintf("%s r%d, r%d, r%d", name, rD, rA, rB)
+	}
+
+	// Cache management.
+	cache := map[uint32]string{54: "dcbst", 86: "dcbf", 246: "dcbtst", 278: "dcbt", 470: "dcbi", 982: "icbi", 1014: "dcbz"}
+	if name, ok := cache[xo]; ok {
+		return fmt.Sprintf("%s r%d, r%d", name, rA, rB)
+	}
+
+	switch xo {
+	case 0:
+		return formatInstruction("cmpw", crField(rD), fmt.Sprintf("r%d", rA), fmt.Sprintf("r%d", rB))
+	case 4:
+		return fmt.Sprintf("tw %d, r%d, r%d", rD, rA, rB)
+	case 19:
+		return fmt.Sprintf("mfcr r%d", rD)
+	case 26:
+		return fmt.Sprintf("cntlzw%s r%d, r%d", record, rA, rD)
+	case 32:
+		return formatInstruction("cmplw", crField(rD), fmt.Sprintf("r%d", rA), fmt.Sprintf("r%d", rB))
+	case 83:
+		return fmt.Sprintf("mfmsr r%d", rD)
+	case 144:
+		return fmt.Sprintf("mtcrf 0x%x, r%d", (word>>12)&0xff, rD)
+	case 146:
+		return fmt.Sprintf("mtmsr r%d", rD)
+	case 339, 467:
+		spr := rA | rB<<5
+		name, known := sprNames[spr]
+		if !known {
+			name = fmt.Sprint(spr)
+		}
+
+		if xo == 339 {
+			if spr == 8 || spr == 9 || spr == 1 {
+				return fmt.Sprintf("mf%s r%d", name, rD)
+			}
+			return fmt.Sprintf("mfspr r%d, %s", rD, name)
+		}
+		if spr == 8 || spr == 9 || spr == 1 {
+			return fmt.Sprintf("mt%s r%d", name, rD)
+		}
+		return fmt.Sprintf("mtspr %s, r%d", name, rD)
+	case 371:
+		return fmt.Sprintf("mftb r%d", rD)
+	case 598:
+		return "sync"
+	case 824:
+		return fmt.Sprintf("srawi%s r%d, r%d, %d", record, rA, rD, rB)
+	case 854:
+		return "eieio"
+	case 922:
+		return fmt.Sprintf("extsh%s r%d, r%d", record, rA, rD)
+	case 954:
+		return fmt.Sprintf("extsb%s r%d, r%d", record, rA, rD)
+	}
+
+	return fmt.Sprintf(".long 0x%08x", word)
+}
+
+// disassembleFloat handles floating-point arithmetic within opcodes 59 (single) and 63 (double).
+func disassembleFloat(word uint32) string {
+	single := word>>26 == 59
+	fD := (word >> 21) & 0x1f
+	fA := (word >> 16) & 0x1f
+	fB := (word >> 11) & 0x1f
+	fC := (word >> 6) & 0x1f
+	record := ""
+	if word&1 == 1 {
+		record = "."
+	}
+	suffix := ""
+	if single {
+		suffix = "s"
+	}
+
+	// A-form instructions have a 5-bit extended opcode.
+	switch (word >> 1) & 0x1f {
+	case 18:
+		return fmt.Sprintf("fdiv%s%s f%d, f%d, f%d", suffix, record, fD, fA, fB)
+	case 20:
+		return fmt.Sprintf("fsub%s%s f%d, f%d, f%d", suffix, record, fD, fA, fB)
+	case 21:
+		return fmt.Sprintf("fadd%s%s f%d, f%d, f%d", suffix, record, fD, fA, fB)
+	case 25:
+		return fmt.Sprintf("fmul%s%s f%d, f%d, f%d", suffix, record, fD, fA, fC)
+	case 28:
+		return fmt.Sprintf("fmsub%s%s f%d, f%d, f%d, f%d", suffix, record, fD, fA, fC, fB)
+	case 29:
+		return fmt.Sprintf("fmadd%s%s f%d, f%d, f%d, f%d", suffix, record, fD, fA, fC, fB)
+	}
+
+	if single {
+		return fmt.Sprintf(".long 0x%08x", word)
+	}
+
+	switch (word >> 1) & 0x3ff {
+	case 0:
+		return fmt.Sprintf("fcmpu cr%d, f%d, f%d", fD>>2, fA, fB)
+	case 12:
+		return fmt.Sprintf("frsp%s f%d, f%d", record, fD, fB)
+	case 15:
+		return fmt.Sprintf("fctiwz%s f%d, f%d", record, fD, fB)
+	case 32:
+		return fmt.Sprintf("fcmpo cr%d, f%d, f%d", fD>>2, fA, fB)
+	case 40:
+		return fmt.Sprintf("fneg%s f%d, f%d", record, fD, fB)
+	case 72:
+		return fmt.Sprintf("fmr%s f%d, f%d", record, fD, fB)
+	case 264:
+		return fmt.Sprintf("fabs%s f%d, f%d", record, fD, fB)
+	}
+
+	return fmt.Sprintf(".long 0x%08x", word)
+}
+
+// DisassembleBytes disassembles the given bytes, located at the given address,
+// returning one line per instruction. Trailing bytes not forming a full instruction are ignored.
+func DisassembleBytes(contents []byte, address uint32) []string {
+	var lines []string
+	for i := 0; i+4 <= len(contents); i += 4 {
+		var instr powerpc.Instruction
+		copy(instr[:], contents[i:i+4])
+		lines = append(lines, Disassemble(instr, address+uint32(i)))
+	}
+
+	return lines
+}
+
+// DisassembleLabeled disassembles the given bytes as DisassembleBytes does, additionally annotating
+// the target of each branch with its symbol, such as "bl 0x800c242c <SSLSetRootCA>". Symbols may be nil.
+func DisassembleLabeled(contents []byte, address uint32, symbols *SymbolMap) []string {
+	lines := DisassembleBytes(contents, address)
+	for i := range lines {
+		var instr powerpc.Instruction
+		copy(instr[:], contents[i*4:i*4+4])
+
+		target, ok := branchTarget(instr, address+uint32(i*4))
+		if !ok {
+			continue
+		}
+		if label := symbols.Label(target); label != "" {
+			lines[i] += fmt.Sprintf(" <%s>", label)
+		}
+	}
+
+	return lines
+}
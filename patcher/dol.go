@@ -0,0 +1,298 @@
+package patcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidDOL         = errors.New("main DOL is too small to contain a header")
+	ErrNoFreeSection      = errors.New("the main DOL has no unused section slots remaining")
+	ErrSectionOverlap     = errors.New("the new section would overlap an existing section or BSS")
+	ErrSectionOutsideMEM1 = errors.New("the new section would not reside within MEM1, between 0x80000000 and 0x81800000")
+	ErrSectionWithinStack = errors.New("the new sections would overlap the stack, which lies between the BSS and __ArenaLo")
+)
+
+const (
+	// dolTextSlots and dolDataSlots are the amount of sections a DOL header is able to describe.
+	dolTextSlots = 7
+	dolDataSlots = 11
+
+	// dolSectionAlignment is the alignment sections are placed at, both within the file and memory.
+	dolSectionAlignment = 32
+)
+
+// dolHeader represents the header at the start of every DOL.
+// Offsets are within the file, while addresses are virtual.
+type dolHeader struct {
+	TextOffsets   [dolTextSlots]uint32
+	DataOffsets   [dolDataSlots]uint32
+	TextAddresses [dolTextSlots]uint32
+	DataAddresses [dolDataSlots]uint32
+	TextSizes     [dolTextSlots]uint32
+	DataSizes     [dolDataSlots]uint32
+	BSSAddress    uint32
+	BSSSize       uint32
+	EntryPoint    uint32
+	_             [0x1c]byte
+}
+
+// DOLSection describes a single text or data section within a DOL.
+type DOLSection struct {
+	// Name is a human-readable name, such as "text0" or "data3".
+	Name string
+
+	// IsText is whether this section contains executable code.
+	IsText bool
+
+	// Offset is where this section begins within the file.
+	Offset uint32
+
+	// Address is where this section is loaded in memory.
+	Address uint32
+
+	// Size is the length of this section.
+	Size uint32
+}
+
+// DOL describes the layout of a DOL.
+type DOL struct {
+	// Sections contains all non-empty text and data sections.
+	Sections []DOLSection
+
+	// BSSAddress and BSSSize describe the uninitialized region.
+	BSSAddress uint32
+	BSSSize    uint32
+
+	// EntryPoint is the address execution begins at.
+	EntryPoint uint32
+}
+
+// ParseDOL parses the header of the given DOL.
+func ParseDOL(contents []byte) (*DOL, error) {
+	var header dolHeader
+	if len(contents) < binary.Size(header) {
+		return nil, ErrInvalidDOL
+	}
+
+	err := binary.Read(bytes.NewReader(contents), binary.BigEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	dol := DOL{
+		BSSAddress: header.BSSAddress,
+		BSSSize:    header.BSSSize,
+		EntryPoint: header.EntryPoint,
+	}
+
+	for i := range header.TextOffsets {
+		if header.TextSizes[i] == 0 {
+			continue
+		}
+
+		dol.Sections = append(dol.Sections, DOLSection{
+			Name:    fmt.Sprintf("text%d", i),
+			IsText:  true,
+			Offset:  header.TextOffsets[i],
+			Address: header.TextAddresses[i],
+			Size:    header.TextSizes[i],
+		})
+	}
+
+	for i := range header.DataOffsets {
+		if header.DataSizes[i] == 0 {
+			continue
+		}
+
+		dol.Sections = append(dol.Sections, DOLSection{
+			Name:    fmt.Sprintf("data%d", i),
+			IsText:  false,
+			Offset:  header.DataOffsets[i],
+			Address: header.DataAddresses[i],
+			Size:    header.DataSizes[i],
+		})
+	}
+
+	return &dol, nil
+}
+
+// SectionAtOffset returns the section containing the given file offset, or nil if none do.
+func (d *DOL) SectionAtOffset(offset int) *DOLSection {
+	for i, section := range d.Sections {
+		if uint32(offset) >= section.Offset && uint32(offset) < section.Offset+section.Size {
+			return &d.Sections[i]
+		}
+	}
+
+	return nil
+}
+
+// AddressOf returns the virtual address of the given file offset.
+// It returns false if the offset is not within any section.
+func (d *DOL) AddressOf(offset int) (uint32, bool) {
+	section := d.SectionAtOffset(offset)
+	if section == nil {
+		return 0, false
+	}
+
+	return section.Address + (uint32(offset) - section.Offset), true
+}
+
+// SectionAtAddress returns the section containing the given virtual address, or nil if none do.
+func (d *DOL) SectionAtAddress(address uint32) *DOLSection {
+	for i, section := range d.Sections {
+		if address >= section.Address && address-section.Address < section.Size {
+			return &d.Sections[i]
+		}
+	}
+
+	return nil
+}
+
+// OffsetOf returns the file offset of the given virtual address.
+// It returns an AddressError if the address is not within any section.
+func (d *DOL) OffsetOf(address uint32) (int, error) {
+	section := d.SectionAtAddress(address)
+	if section == nil {
+		return 0, &AddressError{Address: address}
+	}
+
+	return int(section.Offset + (address - section.Address)), nil
+}
+
+// End returns the first address following all sections and BSS.
+func (d *DOL) End() uint32 {
+	end := d.BSSAddress + d.BSSSize
+	for _, section := range d.Sections {
+		if section.Address+section.Size > end {
+			end = section.Address + section.Size
+		}
+	}
+
+	return end
+}
+
+// overlaps returns whether the given range of addresses overlaps any section or BSS.
+func (d *DOL) overlaps(address uint32, size uint32) bool {
+	end := uint64(address) + uint64(size)
+	if uint64(d.BSSAddress) < end && uint64(address) < uint64(d.BSSAddress)+uint64(d.BSSSize) {
+		return true
+	}
+
+	for _, section := range d.Sections {
+		if uint64(section.Address) < end && uint64(address) < uint64(section.Address)+uint64(section.Size) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AppendSection returns a copy of the given DOL with a new, empty section of the given size
+// loaded at the given address, alongside a description of it. Its contents are zeroed, and are
+// placed at the end of the file. Both its address and size are aligned to 32 bytes, and it must reside within MEM1.
+func AppendSection(contents []byte, isText bool, address uint32, size uint32) ([]byte, DOLSection, error) {
+	var header dolHeader
+	if len(contents) < binary.Size(header) {
+		return nil, DOLSection{}, ErrInvalidDOL
+	}
+
+	err := binary.Read(bytes.NewReader(contents), binary.BigEndian, &header)
+	if err != nil {
+		return nil, DOLSection{}, err
+	}
+
+	layout, err := ParseDOL(contents)
+	if err != nil {
+		return nil, DOLSection{}, err
+	}
+
+	address = alignUp(address, dolSectionAlignment)
+	size = alignUp(size, dolSectionAlignment)
+	if address < mem1Start || uint64(address)+uint64(size) > uint64(mem1End) {
+		return nil, DOLSection{}, ErrSectionOutsideMEM1
+	}
+	if layout.overlaps(address, size) {
+		return nil, DOLSection{}, ErrSectionOverlap
+	}
+
+	// Determine an unused slot for our section.
+	offsets, addresses, sizes := header.DataOffsets[:], header.DataAddresses[:], header.DataSizes[:]
+	prefix := "data"
+	if isText {
+		offsets, addresses, sizes = header.TextOffsets[:], header.TextAddresses[:], header.TextSizes[:]
+		prefix = "text"
+	}
+
+	slot := -1
+	for i := range sizes {
+		if sizes[i] == 0 {
+			slot = i
+			break
+		}
+	}
+	if slot == -1 {
+		return nil, DOLSection{}, ErrNoFreeSection
+	}
+
+	offset := alignUp(uint32(len(contents)), dolSectionAlignment)
+	offsets[slot] = offset
+	addresses[slot] = address
+	sizes[slot] = size
+
+	var updated bytes.Buffer
+	err = binary.Write(&updated, binary.BigEndian, header)
+	if err != nil {
+		return nil, DOLSection{}, err
+	}
+
+	appended := make([]byte, offset+size)
+	copy(appended, contents)
+	copy(appended, updated.Bytes())
+
+	return appended, DOLSection{
+		Name:    fmt.Sprintf("%s%d", prefix, slot),
+		IsText:  isText,
+		Offset:  offset,
+		Address: address,
+		Size:    size,
+	}, nil
+}
+
+// TruncateSections returns a copy of the given DOL truncated to the given size, removing all sections
+// residing beyond it from its header. It reverses AppendSection given the DOL's original size.
+func TruncateSections(contents []byte, size int) ([]byte, error) {
+	var header dolHeader
+	if size < binary.Size(header) || size > len(contents) {
+		return nil, ErrInvalidDOL
+	}
+
+	err := binary.Read(bytes.NewReader(contents), binary.BigEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range header.TextSizes {
+		if header.TextSizes[i] != 0 && int(header.TextOffsets[i]) >= size {
+			header.TextOffsets[i], header.TextAddresses[i], header.TextSizes[i] = 0, 0, 0
+		}
+	}
+	for i := range header.DataSizes {
+		if header.DataSizes[i] != 0 && int(header.DataOffsets[i]) >= size {
+			header.DataOffsets[i], header.DataAddresses[i], header.DataSizes[i] = 0, 0, 0
+		}
+	}
+
+	var updated bytes.Buffer
+	err = binary.Write(&updated, binary.BigEndian, header)
+	if err != nil {
+		return nil, err
+	}
+
+	truncated := append([]byte{}, contents[:size]...)
+	copy(truncated, updated.Bytes())
+	return truncated, nil
+}
@@ -0,0 +1,53 @@
+package patcher
+
+// DOLPatch represents a patch applied to the main DOL, declared by the virtual address
+// or symbol it applies at. Its file offset is determined via the sections of the DOL it is applied to.
+type DOLPatch struct {
+	// Name is this patch's name, logged upon application and utilized to disable it.
+	Name string
+
+	// AtAddress is the virtual address this patch should be applied at within version 21.
+	// If neither it nor AtSymbol are present, the patch is applied wherever its
+	// original bytes are found, as with powerpc.Patch.
+	AtAddress uint32
+
+	// AtSymbol optionally names the symbol this patch should be applied at, such as
+	// "ec::isManagedTicket" or "NHTTPi_SocSSLConnect+0x1c". It is preferred over
+	// AtAddress when a symbol map is available, as symbols are specific to each revision.
+	AtSymbol string
+
+	// Signature optionally locates this patch when its original bytes are not present at its address or symbol,
+	// taking precedence over any within Signatures. Patches with neither an address nor a symbol are located
+	// via it, rather than by searching for their original bytes.
+	Signature *Signature
+
+	// AtOffset optionally specifies the offset within the main DOL this patch should be applied at,
+	// taking precedence over both AtAddress and AtSymbol. As offsets are specific to each revision,
+	// it is only utilized by patch sets loaded from files, such as via PatchSetDefinition.
+	AtOffset int
+
+	// Before contains the bytes present within the original file.
+	Before []byte
+
+	// After contains the bytes to replace them with.
+	After []byte
+
+	// DependsOn names patches this patch relies upon, such as those clearing space it is placed within.
+	// If present, they must be applied beforehand. Only patches declaring such a dependency
+	// may write bytes overlapping another patch; any other overlap is rejected.
+	DependsOn []string
+
+	// Labels names every address branches within After may target, such as those labeled within its
+	// assembly and the functions it calls. Any branch targeting another address is rejected by CheckBranches,
+	// provided this patch applies within a text section.
+	Labels Labels
+}
+
+// DOLPatchSet represents multiple related patches applied to the main DOL.
+type DOLPatchSet struct {
+	// Name is this patch set's name, logged upon application.
+	Name string
+
+	// Patches contains all patches within this set.
+	Patches []DOLPatch
+}
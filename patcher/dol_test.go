@@ -0,0 +1,104 @@
+package patcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestAppendSectionRoundTrip(t *testing.T) {
+	original := testDOL(t)
+	appended, section, err := AppendSection(original, true, 0x80422010, 0x50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if section.Address != 0x80422020 || section.Size != 0x60 || section.Offset != testDOLSize {
+		t.Fatalf("unexpected section %+v", section)
+	}
+
+	layout, err := ParseDOL(appended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := layout.SectionAtAddress(0x80422020); found == nil || *found != section {
+		t.Fatalf("appended section %+v is not present within the DOL", section)
+	}
+
+	// Only the header and the end of the DOL may differ.
+	headerSize := binary.Size(dolHeader{})
+	if !bytes.Equal(appended[headerSize:testDOLSize], original[headerSize:]) || len(appended) != testDOLSize+0x60 {
+		t.Fatal("appending a section modified the existing contents of the DOL")
+	}
+
+	truncated, err := TruncateSections(appended, len(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(truncated, original) {
+		t.Fatal("truncating the appended section did not restore the original DOL")
+	}
+}
+
+func TestAppendSectionRejectsInvalidAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint32
+		size    uint32
+		err     error
+	}{
+		{"below MEM1", 0x7ffff000, 0x100, ErrSectionOutsideMEM1},
+		{"within MEM2", 0x90000000, 0x100, ErrSectionOutsideMEM1},
+		{"past the end of MEM1", 0x817fff00, 0x200, ErrSectionOutsideMEM1},
+		{"overlapping text", 0x80004000, 0x100, ErrSectionOverlap},
+		{"overlapping the BSS", 0x8040ff00, 0x200, ErrSectionOverlap},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := AppendSection(testDOL(t), false, test.address, test.size)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, but received %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSectionsMaxCertificateLength(t *testing.T) {
+	tests := []struct {
+		dataSize uint32
+		expected int
+	}{
+		{0, MaxCertificateLength},
+		{0x100, MaxCertificateLength},
+		{0x1000, 0x1000},
+		{0x10000, MaxAppendedCertificateLength},
+	}
+	for _, test := range tests {
+		if actual := (Sections{DataSize: test.dataSize}).MaxCertificateLength(); actual != test.expected {
+			t.Errorf("data size 0x%x permits %d bytes, rather than %d", test.dataSize, actual, test.expected)
+		}
+	}
+}
+
+func TestAppendSectionsRaiseArenaLo(t *testing.T) {
+	p := &Patcher{Options{Sections: Sections{TextSize: 0x100, DataSize: 0x100}}}
+	dol := testDOL(t)
+	_, regions, reservation, err := p.appendSections(dol, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0].Address != 0x80422000 || regions[1].Address != 0x80422100 {
+		t.Fatalf("sections were not placed at __ArenaLo: %+v", regions)
+	}
+
+	raised := MustAssemble("lis r3, 0x8042\naddi r3, r3, 0x2200", 0x80100000, nil)
+	if len(reservation) != 2 || !bytes.Equal(append(reservation[0].After, reservation[1].After...), raised) {
+		t.Fatalf("__ArenaLo was not raised past our sections: %+v", reservation)
+	}
+
+	p.options.Sections.Address = 0x80410000
+	_, _, _, err = p.appendSections(dol, nil)
+	if !errors.Is(err, ErrSectionWithinStack) {
+		t.Fatalf("expected %v, but received %v", ErrSectionWithinStack, err)
+	}
+}
@@ -0,0 +1,319 @@
+package patcher
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMissingBaseDomain      = errors.New("a base domain must be specified")
+	ErrBaseDomainTooLong      = errors.New("the given base domain must not exceed 12 characters")
+	ErrMissingRootCertificate = errors.New("a root certificate must be specified")
+	ErrInvalidSignature       = errors.New("a signature's mask must be the same length as its pattern")
+)
+
+// InvalidWADError represents a WAD, or content within, that could not be loaded.
+type InvalidWADError struct {
+	Err error
+}
+
+func (e *InvalidWADError) Error() string {
+	return fmt.Sprintf("the WAD is corrupt or unreadable: %v", e.Err)
+}
+
+func (e *InvalidWADError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTitleError represents a WAD that is not a version of the Wii Shop Channel we are able to patch.
+type UnsupportedTitleError struct {
+	TitleID      uint64
+	TitleVersion uint16
+}
+
+func (e *UnsupportedTitleError) Error() string {
+	return fmt.Sprintf("title %016x version %d is not supported; expected the Wii Shop Channel (%016x) version %s",
+		e.TitleID, e.TitleVersion, ShopTitleID, supportedVersionList())
+}
+
+// UnknownDOLError represents a main DOL not known for a supported revision,
+// such as one that has been modified.
+type UnknownDOLError struct {
+	TitleVersion uint16
+	Hash         string
+}
+
+func (e *UnknownDOLError) Error() string {
+	return fmt.Sprintf("the main DOL (SHA-1 %s) is not known for version %d", e.Hash, e.TitleVersion)
+}
+
+// UnsupportedPatchError represents a patch without a known offset for a revision.
+type UnsupportedPatchError struct {
+	TitleVersion uint16
+	SetName      string
+	PatchName    string
+}
+
+func (e *UnsupportedPatchError) Error() string {
+	return fmt.Sprintf("patch \"%s\" from \"%s\" has no known offset for version %d", e.PatchName, e.SetName, e.TitleVersion)
+}
+
+// SignatureError represents a signature that did not match exactly once.
+type SignatureError struct {
+	SetName   string
+	PatchName string
+	Matches   int
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("the signature for patch \"%s\" from \"%s\" matched %d locations, rather than exactly one",
+		e.PatchName, e.SetName, e.Matches)
+}
+
+// AddressError represents a virtual address not within any section of the main DOL.
+type AddressError struct {
+	SetName   string
+	PatchName string
+	Address   uint32
+}
+
+func (e *AddressError) Error() string {
+	if e.PatchName == "" {
+		return fmt.Sprintf("address 0x%08x is not within any section of the main DOL", e.Address)
+	}
+
+	return fmt.Sprintf("patch \"%s\" from \"%s\" is declared at address 0x%08x, which is not within any section of the main DOL",
+		e.PatchName, e.SetName, e.Address)
+}
+
+// SymbolError represents a symbol not present within the symbol map, or when no symbol map is available.
+type SymbolError struct {
+	SetName   string
+	PatchName string
+	Symbol    string
+}
+
+func (e *SymbolError) Error() string {
+	if e.PatchName == "" {
+		return fmt.Sprintf("symbol \"%s\" could not be resolved", e.Symbol)
+	}
+
+	return fmt.Sprintf("patch \"%s\" from \"%s\" is declared at symbol \"%s\", which could not be resolved",
+		e.PatchName, e.SetName, e.Symbol)
+}
+
+// OverlapError represents two patches writing overlapping bytes within the main DOL,
+// where the latter does not declare the former as a dependency.
+type OverlapError struct {
+	SetName        string
+	PatchName      string
+	OtherSetName   string
+	OtherPatchName string
+	Offset         int
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("patch \"%s\" from \"%s\" overlaps patch \"%s\" from \"%s\" at offset 0x%x without declaring a dependency upon it",
+		e.PatchName, e.SetName, e.OtherPatchName, e.OtherSetName, e.Offset)
+}
+
+// DependencyOrderError represents a patch applied prior to a patch it depends upon.
+type DependencyOrderError struct {
+	SetName    string
+	PatchName  string
+	Dependency string
+}
+
+func (e *DependencyOrderError) Error() string {
+	return fmt.Sprintf("patch \"%s\" from \"%s\" depends on \"%s\", which is applied after it",
+		e.PatchName, e.SetName, e.Dependency)
+}
+
+// UnknownDependencyError represents a patch depending upon a patch that is neither selected nor available.
+type UnknownDependencyError struct {
+	SetName    string
+	PatchName  string
+	Dependency string
+}
+
+func (e *UnknownDependencyError) Error() string {
+	return fmt.Sprintf("patch \"%s\" from \"%s\" depends on \"%s\", which is not the name of any selected or available patch",
+		e.PatchName, e.SetName, e.Dependency)
+}
+
+// BranchError represents a branch within a patch targeting an address other than a declared label,
+// such as one outside of any text section or within the middle of a different patch.
+type BranchError struct {
+	SetName   string
+	PatchName string
+	Address   uint32
+	Target    uint32
+	Reason    string
+}
+
+func (e *BranchError) Error() string {
+	return fmt.Sprintf("patch \"%s\" from \"%s\" branches at 0x%08x to 0x%08x, %s",
+		e.PatchName, e.SetName, e.Address, e.Target, e.Reason)
+}
+
+// RestorationError represents restored contents differing from the original, as preserved upon patching.
+type RestorationError struct {
+	Content  string
+	Expected string
+	Actual   string
+}
+
+func (e *RestorationError) Error() string {
+	return fmt.Sprintf("the restored %s has SHA-1 %s, whereas the original had %s", e.Content, e.Actual, e.Expected)
+}
+
+// DeltaMismatchError represents a content differing from that a delta expects,
+// either within the original WAD or once reconstructed.
+type DeltaMismatchError struct {
+	Index         uint16
+	Expected      [20]byte
+	Actual        [20]byte
+	Reconstructed bool
+}
+
+func (e *DeltaMismatchError) Error() string {
+	if e.Reconstructed {
+		return fmt.Sprintf("content %d was reconstructed with SHA-1 %x, whereas %x was expected", e.Index, e.Actual, e.Expected)
+	}
+
+	return fmt.Sprintf("content %d of the original WAD has SHA-1 %x, whereas the delta expects %x; please verify it is an unmodified copy",
+		e.Index, e.Actual, e.Expected)
+}
+
+// PatchError represents a patch that could not be applied,
+// such as when its original bytes are not present.
+type PatchError struct {
+	SetName   string
+	PatchName string
+	Offset    int
+	Err       error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("unable to apply patch \"%s\" from \"%s\" at offset 0x%x: %v", e.PatchName, e.SetName, e.Offset, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// CertificateTooLargeError represents a root certificate exceeding the space available.
+type CertificateTooLargeError struct {
+	Size    int
+	Maximum int
+}
+
+func (e *CertificateTooLargeError) Error() string {
+	return fmt.Sprintf("the root certificate is %d bytes, exceeding the maximum length possible of %d bytes; "+
+		"please verify parameters passed for generation and reduce its size", e.Size, e.Maximum)
+}
+
+// OutOfSpaceError represents space requested by a patch that no free region of the main DOL is able to hold.
+// If Reach is non-zero, only space within Reach bytes of From was considered.
+type OutOfSpaceError struct {
+	Name       string
+	Size       uint32
+	Alignment  uint32
+	Executable bool
+	From       uint32
+	Reach      uint32
+}
+
+func (e *OutOfSpaceError) Error() string {
+	kind := "data"
+	if e.Executable {
+		kind = "code"
+	}
+
+	regions := "no free region of the main DOL"
+	if e.Reach != 0 {
+		regions = fmt.Sprintf("no free region of the main DOL within 0x%x bytes of 0x%08x", e.Reach, e.From)
+	}
+
+	return fmt.Sprintf("unable to allocate %d bytes (aligned to %d) of %s for %s: %s has sufficient space remaining",
+		e.Size, e.Alignment, kind, e.Name, regions)
+}
+
+// BranchRangeError represents a branch whose target lies beyond the range of its displacement,
+// such as space allocated too far from the code branching to it.
+type BranchRangeError struct {
+	From uint32
+	To   uint32
+}
+
+func (e *BranchRangeError) Error() string {
+	return fmt.Sprintf("unable to branch from 0x%08x to 0x%08x, as it is beyond the range of the branch", e.From, e.To)
+}
+
+// ARCFileMissingError represents a file expected within the main ARC that is not present.
+type ARCFileMissingError struct {
+	Path string
+	Err  error
+}
+
+func (e *ARCFileMissingError) Error() string {
+	return fmt.Sprintf("%s is not present within the main ARC: %v", e.Path, e.Err)
+}
+
+func (e *ARCFileMissingError) Unwrap() error {
+	return e.Err
+}
+
+// AssemblyError represents an instruction that could not be assembled.
+type AssemblyError struct {
+	// Line is the line the instruction is on, beginning at 1.
+	Line   int
+	Source string
+	Err    error
+}
+
+func (e *AssemblyError) Error() string {
+	return fmt.Sprintf("unable to assemble \"%s\" on line %d: %v", e.Source, e.Line, e.Err)
+}
+
+func (e *AssemblyError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownPatchSetError represents a selected patch set that is neither available nor loaded from a file.
+type UnknownPatchSetError struct {
+	ID string
+}
+
+func (e *UnknownPatchSetError) Error() string {
+	return fmt.Sprintf("unknown patch set \"%s\"", e.ID)
+}
+
+// UnknownPatchError represents a disabled patch that is not present within any patch set.
+type UnknownPatchError struct {
+	Name string
+}
+
+func (e *UnknownPatchError) Error() string {
+	return fmt.Sprintf("unknown patch \"%s\"", e.Name)
+}
+
+// PatchDefinitionError represents a patch set loaded from a file that is invalid.
+// PatchName is empty if the patch set itself is invalid.
+type PatchDefinitionError struct {
+	ID        string
+	PatchName string
+	Err       error
+}
+
+func (e *PatchDefinitionError) Error() string {
+	if e.PatchName == "" {
+		return fmt.Sprintf("patch set \"%s\" is invalid: %v", e.ID, e.Err)
+	}
+
+	return fmt.Sprintf("patch \"%s\" within patch set \"%s\" is invalid: %v", e.PatchName, e.ID, e.Err)
+}
+
+func (e *PatchDefinitionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,250 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wii-tools/arclib"
+	"strings"
+)
+
+const (
+	OperaFilterPath    = "arc/opera/myfilter.ini"
+	OperaCertStorePath = "arc/opera/opcacrt6.dat"
+)
+
+var ErrInvalidCertStore = errors.New("the Opera cert store is malformed")
+
+// modifyARC replaces the Opera filter and certificate store within the given ARC.
+func modifyARC(arc *arclib.ARC, filter Filter, rootCertificate []byte) error {
+	filterFile, err := arc.OpenFile(OperaFilterPath)
+	if err != nil {
+		return &ARCFileMissingError{OperaFilterPath, err}
+	}
+
+	certStoreFile, err := arc.OpenFile(OperaCertStorePath)
+	if err != nil {
+		return &ARCFileMissingError{OperaCertStorePath, err}
+	}
+
+	certStore, err := GenerateOperaCertStore(rootCertificate)
+	if err != nil {
+		return err
+	}
+
+	filterFile.Write(GenerateFilter(filter))
+	certStoreFile.Write(certStore)
+	return nil
+}
+
+// FilterWithBaseDomain returns the given filter, additionally permitting
+// file:/cnt/* and the given base domain as Opera requires.
+func FilterWithBaseDomain(filter Filter, baseDomain string) Filter {
+	return Filter{
+		Include: append([]string{"file:/cnt/*", fmt.Sprintf("https://*.%s/*", baseDomain)}, filter.Include...),
+		Exclude: filter.Exclude,
+	}
+}
+
+// GenerateFilter returns the contents of Opera's myfilter.ini for the given filter.
+func GenerateFilter(filter Filter) []byte {
+	// TODO(spotlightishere): Find an INI parser that handles reading an array from a section
+	// As I could not - and I spent a good while looking - and do not want to implement my own parser,
+	// no matter how rudimentary - we write the original file's structure verbatim.
+	contents := `[prefs]
+prioritize excludelist=0
+
+[include]
+`
+	for _, entry := range filter.Include {
+		contents += entry + "\n"
+	}
+
+	contents += "\n[exclude]"
+	for _, entry := range filter.Exclude {
+		contents += "\n" + entry
+	}
+
+	// Replace UNIX line (LR) returns with that of Windows (CRLF).
+	return bytes.ReplaceAll([]byte(contents), []byte("\n"), []byte("\r\n"))
+}
+
+// ParseFilter returns the entries within the given contents of Opera's myfilter.ini.
+func ParseFilter(contents []byte) Filter {
+	var filter Filter
+	var section string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		switch section {
+		case "[include]":
+			filter.Include = append(filter.Include, line)
+		case "[exclude]":
+			filter.Exclude = append(filter.Exclude, line)
+		}
+	}
+
+	return filter
+}
+
+// Tag represents a single byte representing a tag's ID.
+type Tag byte
+
+const (
+	TagSSLCertType     = 0x20
+	TagSSLCertName     = 0x21
+	TagSSLCertSubject  = 0x22
+	TagSSLCertContents = 0x23
+
+	TagCACertificate   = 0x02
+	TagUserCertificate = 0x03
+	TagUserPassword    = 0x04
+)
+
+// generateTag generates a byte representation of a tag and contents.
+func generateTag(tag Tag, tagContents []byte) []byte {
+	// Tag ID
+	contents := []byte{
+		byte(tag),
+	}
+	// Tag length
+	contents = append(contents, fourByte(uint32(len(tagContents)))...)
+	// Tag contents
+	contents = append(contents, tagContents...)
+
+	return contents
+}
+
+// GenerateOperaCertStore returns the contents of a custom Opera cert store
+// containing the given root certificate, in DER form.
+func GenerateOperaCertStore(rootCertificate []byte) ([]byte, error) {
+	// Parse our loaded root certificate, in DER form.
+	rootCertContents := rootCertificate
+	rootCert, err := x509.ParseCertificate(rootCertContents)
+	if err != nil {
+		return nil, err
+	}
+
+	// The following array was done manually after several hours of tinkering.
+	// Please refer to docs/opcacrt6.yml for more about the structure of this file.
+	// TODO(spotlightishere): Is it possible to somehow generate a structure for easier access?
+	header := []byte{
+		// File version number
+		0x00, 0x00, 0x10, 0x00,
+		// App version number
+		0x05, 0x05, 0x00, 0x23,
+		// ID tag "length" - always one byte
+		0x00, 0x01,
+		// Length field byte length - always four bytes
+		0x00, 0x04,
+	}
+
+	// It's unclear on what 0x01 is supposed to represent,
+	// but it must be a CA certificate.
+	certTypeTag := generateTag(TagSSLCertType, []byte{
+		0x0, 0x0, 0x0, 0x1,
+	})
+
+	// We can obtain the name and subject from the root certificate.
+	certNameTag := generateTag(TagSSLCertName, []byte(rootCert.Subject.CommonName))
+	certSubjectTag := generateTag(TagSSLCertSubject, rootCert.RawSubject)
+
+	// Finally, our actual certificate.
+	certContentsTag := generateTag(TagSSLCertContents, rootCertContents)
+
+	// We must enclose our type, name, subject and contents tag in a CA certificate tag.
+	bundledContents := append(certTypeTag, certNameTag...)
+	bundledContents = append(bundledContents, certSubjectTag...)
+	bundledContents = append(bundledContents, certContentsTag...)
+
+	caCertTag := generateTag(TagCACertificate, bundledContents)
+
+	// Thankfully, that is all.
+	// In the end, we have a structure similar to the following:
+	// - header (file/app version, id/length byte length)
+	// - ca certificate
+	//   - id
+	//   - length
+	//   - value:
+	//     - type tag (id, length, value)
+	//     - type name (id, length, value)
+	//     - type subject (id, length, value)
+	//     - type contents (id, length, value)
+	return append(header, caCertTag...), nil
+}
+
+// ParseOperaCertStore returns all CA certificates within the given Opera cert store, in DER form.
+func ParseOperaCertStore(contents []byte) ([][]byte, error) {
+	// Skip our header, as written by GenerateOperaCertStore.
+	if len(contents) < 12 {
+		return nil, ErrInvalidCertStore
+	}
+
+	tags, err := parseTags(contents[12:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certificates [][]byte
+	for _, tag := range tags {
+		if tag.ID != TagCACertificate {
+			continue
+		}
+
+		bundled, err := parseTags(tag.Contents)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, inner := range bundled {
+			if inner.ID == TagSSLCertContents {
+				certificates = append(certificates, inner.Contents)
+			}
+		}
+	}
+
+	return certificates, nil
+}
+
+// parsedTag represents a tag read by parseTags.
+type parsedTag struct {
+	ID       Tag
+	Contents []byte
+}
+
+// parseTags reads all consecutive tags within the given contents, as written by generateTag.
+func parseTags(contents []byte) ([]parsedTag, error) {
+	var tags []parsedTag
+	for len(contents) != 0 {
+		if len(contents) < 5 {
+			return nil, ErrInvalidCertStore
+		}
+
+		length := binary.BigEndian.Uint32(contents[1:5])
+		if uint64(length) > uint64(len(contents)-5) {
+			return nil, ErrInvalidCertStore
+		}
+
+		tags = append(tags, parsedTag{Tag(contents[0]), contents[5 : 5+length]})
+		contents = contents[5+length:]
+	}
+
+	return tags, nil
+}
+
+// fourByte returns 4 bytes, suitable for the given length.
+func fourByte(value uint32) []byte {
+	holder := make([]byte, 4)
+	binary.BigEndian.PutUint32(holder, value)
+	return holder
+}
@@ -1,4 +1,4 @@
-package main
+package patcher
 
 import (
 	"strings"
@@ -14,51 +14,52 @@ const (
 	ECommerceBaseURL   = "https://ecs.shop.wii.com/ecs/services/ECommerceSOAP"
 )
 
-// PatchBaseDomain replaces all Nintendo domains to be the user's
-// specified base domain.
+// PatchBaseDomain replaces all Nintendo domains to be the given base domain.
 // See docs/patch_base_domain.md for more information.
-func PatchBaseDomain() PatchSet {
-	return PatchSet{
+func PatchBaseDomain(baseDomain string) DOLPatchSet {
+	return DOLPatchSet{
 		Name: "Change Base Domain",
-		Patches: []Patch{
+		Patches: []DOLPatch{
 			{
 				Name: "Modify /startup domain",
 
 				Before: []byte(ShowManualURL),
-				After:  padReplace(ShowManualURL),
+				After:  padReplace(ShowManualURL, baseDomain),
 			},
 			{
-				Name:     "Modify oss-auth URL",
-				AtOffset: 3180692,
+				Name:      "Modify oss-auth URL",
+				AtAddress: 0x8030c794,
 
 				Before: []byte(GetLogURL),
-				After:  padReplace(GetLogURL),
+				After:  padReplace(GetLogURL, baseDomain),
 			},
 			{
-				Name:     "Modify trusted base domain prefix",
-				AtOffset: 3323432,
+				Name:      "Modify trusted base domain prefix",
+				AtAddress: 0x8032f528,
 
 				Before: []byte(TrustedDomain),
-				After:  padReplace(TrustedDomain),
+				After:  padReplace(TrustedDomain, baseDomain),
 			},
 			{
-				Name:     "Modify ECS SOAP endpoint URL",
-				AtOffset: 3268896,
+				Name:      "Modify ECS SOAP endpoint URL",
+				AtAddress: 0x80322020,
 
 				Before: []byte(ECommerceBaseURL),
-				After:  padReplace(ECommerceBaseURL),
+				After:  padReplace(ECommerceBaseURL, baseDomain),
 			},
 			{
 				Name: "Wildcard replace other instances",
 
 				Before: []byte(NintendoBaseDomain),
-				After:  padReplace(baseDomain),
+				After:  padReplace(baseDomain, baseDomain),
 			},
 		},
 	}
 }
 
-func padReplace(url string) []byte {
+// padReplace replaces the Nintendo base domain within the given URL,
+// padding the result with null bytes to retain its original length.
+func padReplace(url string, baseDomain string) []byte {
 	replaced := strings.ReplaceAll(url, NintendoBaseDomain, baseDomain)
 
 	// See if we truly need to pad.
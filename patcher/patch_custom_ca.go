@@ -0,0 +1,129 @@
+package patcher
+
+import (
+	. "github.com/wii-tools/powerpc"
+)
+
+// LoadCustomCA loads the given root certificate, in DER form,
+// into the IOS trust store for EC usage. Space for the certificate is allocated via the given allocator,
+// and branch targets are resolved via the given symbols if possible, which may be nil.
+// See docs/patch_custom_ca_ios.md for more information.
+func LoadCustomCA(rootCertificate []byte, symbols *SymbolMap, space *Allocator) (DOLPatchSet, error) {
+	certificate, err := space.Allocate("the root certificate", uint32(len(rootCertificate)), 4, false)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+
+	labels := Labels{
+		"SSLSetRootCA":        symbols.AddressOr("SSLSetRootCA", 0x800c242c),
+		"SSLSetBuiltinRootCA": symbols.AddressOr("SSLSetBuiltinRootCA", 0x800c2574),
+		"FUNCTION_PROLOG":     0x800acbb0,
+		"CERTIFICATE":         certificate,
+		"CERTIFICATE_LENGTH":  uint32(len(rootCertificate)),
+	}
+
+	// Our replacement is assembled beforehand, so that the labels its branches target may be declared.
+	// As it references the space allocated above, it may not be assembled if such is out of range.
+	after, defined, err := AssembleSource(`
+		# Our certificate is present within the space allocated above.
+		# r4 is the second parameter of SSLSetRootCA, the ca_cert pointer.
+		lis r4, CERTIFICATE@h
+		ori r4, r4, CERTIFICATE@l
+
+		# r5 is the third parameter of SSLSetRootCA, the cert_length field.
+		xor r5, r5, r5
+		addi r5, r5, CERTIFICATE_LENGTH
+
+		# r3 is the first parameter of SSLSetRootCA, the ssl_fd.
+		# We load it exactly as Nintendo does.
+		lwz r3, 0xac(r28)
+
+		# SSLSetRootCA(ssl_fd, ca_cert, cert_index)
+		bl SSLSetRootCA
+
+		# Check for errors
+		cmpwi r3, 0
+		beq CONTINUE_CONNECTING
+
+		# Return error -1004 if failed
+		li r3, -1004
+		b FUNCTION_PROLOG
+
+		# NOP the rest in order to allow execution to continue.
+		nop
+		nop
+		nop
+		nop
+		nop
+		nop
+		nop
+
+	CONTINUE_CONNECTING:
+	`, 0x800acad0, labels, nil)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+
+	return DOLPatchSet{
+		Name: "Load Custom CA within IOS",
+		Patches: []DOLPatch{
+			{
+				Name:      "Insert custom CA into free space",
+				AtAddress: certificate,
+
+				Before: EmptyBytes(len(rootCertificate)),
+				After:  rootCertificate,
+			},
+			{
+				Name:      "Modify NHTTPi_SocSSLConnect to load cert",
+				AtAddress: 0x800acad0,
+
+				Before: MustAssemble(`
+					# Check whether internals->ca_cert is null
+					lwz r4, 0xc0(r28)
+					cmpwi r4, 0
+					# If it is, load the built-in root certificate.
+					beq LOAD_BUILTIN_ROOT_CA
+
+					# It seems we are loading a custom certificate.
+					# r3 -> ssl_fd
+					# r4 -> ca_cert, loaded previously
+					# r5 -> cert_length
+					lwz r3, 0xac(r28)
+					lwz r5, 0xc4(r28)
+					# SSLSetRootCA(ssl_fd, ca_cert, cert_index)
+					bl SSLSetRootCA
+
+					# Check if successful
+					cmpwi r3, 0
+					beq CONTINUE_CONNECTING
+
+					# Return error -1004 if failed
+					li r3, -1004
+					b FUNCTION_PROLOG
+
+				LOAD_BUILTIN_ROOT_CA:
+					# It seems we are loading the built-in root CA.
+					# r3 -> ssl_fd
+					# r4 -> cert_length
+					lwz r3, 0xac(r28)
+					lwz r4, 0xd8(r28)
+					# SSLSetBuiltinRootCA(ssl_fd, cert_index)
+					bl SSLSetBuiltinRootCA
+
+					# Check if successful
+					cmpwi r3, 0
+					beq CONTINUE_CONNECTING
+
+					# Return error -1004 if failed
+					li r3, -1004
+					b FUNCTION_PROLOG
+
+				CONTINUE_CONNECTING:
+				`, 0x800acad0, labels),
+				After:  after,
+				Labels: labels.with(defined),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,14 @@
+package patcher
+
+var PatchECCfgPath = DOLPatchSet{
+	Name: "Change EC Configuration Path",
+	Patches: []DOLPatch{
+		{
+			Name:      "Rename ec.cfg to osc.cfg",
+			AtAddress: 0x8032e7a0,
+
+			Before: []byte("ec.cfg\x00\x00"),
+			After:  []byte("osc.cfg\x00"),
+		},
+	},
+}
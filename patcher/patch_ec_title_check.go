@@ -0,0 +1,65 @@
+package patcher
+
+var NegateECTitle = DOLPatchSet{
+	Name: "Negate EC Title Check",
+
+	Patches: []DOLPatch{
+		{
+			Name:      "Permit downloading all titles",
+			AtAddress: 0x800a6940,
+			AtSymbol:  "ec::allowDownloadByApp",
+
+			// Generic function prolog
+			Before: MustAssemble(`
+				stwu r1, -0x20(r1)
+				mflr r0
+			`, 0x800a6940, nil),
+
+			// Immediately return true
+			After: MustAssemble(`
+				li r3, 1
+				blr
+			`, 0x800a6940, nil),
+		},
+		{
+			Name:      "Mark all titles as managed",
+			AtAddress: 0x800a6d30,
+			AtSymbol:  "ec::isManagedTitle",
+
+			Before: MustAssemble(`
+				stwu r1, -0x10(r1)
+				mflr r0
+			`, 0x800a6d30, nil),
+			After: MustAssemble(`
+				li r3, 1
+				blr
+			`, 0x800a6d30, nil),
+		},
+		{
+			Name:      "Mark all tickets as managed",
+			AtAddress: 0x800a6a40,
+			AtSymbol:  "ec::isManagedTicket",
+			Before: MustAssemble(`
+				stwu r1, -0x10(r1)
+				mflr r0
+			`, 0x800a6a40, nil),
+			After: MustAssemble(`
+				li r3, 1
+				blr
+			`, 0x800a6a40, nil),
+		},
+		{
+			Name:      "Nullify ec::removeAllTitles",
+			AtAddress: 0x8009ef10,
+			AtSymbol:  "ec::removeAllTitles",
+			Before: MustAssemble(`
+				stwu r1, -0x40(r1)
+				mflr r0
+			`, 0x8009ef10, nil),
+			After: MustAssemble(`
+				li r3, 0
+				blr
+			`, 0x8009ef10, nil),
+		},
+	},
+}
@@ -0,0 +1,299 @@
+package patcher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// PatchSetDefinition describes a patch set loaded from a YAML or JSON file, permitting changes
+// to the main DOL to be tried without modifying the patcher. Its patches are applied alongside
+// those within AvailablePatchSets, and are validated in the same manner.
+type PatchSetDefinition struct {
+	// ID is utilized to reference this patch set, and must not be that of an available patch set.
+	ID string `yaml:"id" json:"id"`
+
+	// Name is this patch set's name, logged upon application. If empty, ID is used.
+	Name string `yaml:"name" json:"name,omitempty"`
+
+	// Patches contains all patches within this set, applied in order.
+	Patches []PatchDefinition `yaml:"patches" json:"patches"`
+}
+
+// PatchDefinition describes a single patch within a PatchSetDefinition.
+// As with DOLPatch, it is located via its symbol or address, or otherwise by searching for its original bytes.
+// It may instead be located via its offset within the main DOL.
+type PatchDefinition struct {
+	// Name is this patch's name, utilized to disable it. It must be unique across all patch sets.
+	Name string `yaml:"name" json:"name"`
+
+	// Address is the virtual address this patch applies at, as with DOLPatch.AtAddress.
+	Address uint32 `yaml:"address" json:"address,omitempty"`
+
+	// Symbol is the symbol this patch applies at, as with DOLPatch.AtSymbol.
+	Symbol string `yaml:"symbol" json:"symbol,omitempty"`
+
+	// Offset is the offset within the main DOL this patch applies at, as with DOLPatch.AtOffset.
+	// It may not be combined with Address, Symbol or Signature.
+	Offset uint32 `yaml:"offset" json:"offset,omitempty"`
+
+	// Signature optionally locates this patch as with DOLPatch.Signature, written as with ParseSignature
+	// such as "7c 08 02 a6 ?? ?? ?? ?? 4? 82". SignatureOffset is the distance from its start to the patch.
+	Signature       string `yaml:"signature" json:"signature,omitempty"`
+	SignatureOffset int    `yaml:"signature_offset" json:"signature_offset,omitempty"`
+
+	// Before contains the bytes present within the original file.
+	Before PatchContents `yaml:"before" json:"before"`
+
+	// After contains the bytes to replace them with.
+	After PatchContents `yaml:"after" json:"after"`
+
+	// DependsOn names patches this patch relies upon, as with DOLPatch.DependsOn.
+	DependsOn []string `yaml:"depends_on" json:"depends_on,omitempty"`
+
+	// Labels names addresses its instructions may reference. As with DOLPatch.Labels, branches within After
+	// may only target these, the labels defined within its instructions, and the symbols they reference.
+	Labels Labels `yaml:"labels" json:"labels,omitempty"`
+}
+
+// PatchContents contains the bytes of a patch, specified either as hex such as "38 60 00 01",
+// or as instructions assembled at the patch's address such as ["li r3, 0x1", "blr"].
+type PatchContents struct {
+	Hex          string
+	Instructions []string
+}
+
+// UnmarshalYAML permits contents to be either a string of hex or a list of instructions.
+func (c *PatchContents) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		*c = PatchContents{}
+		return value.Decode(&c.Instructions)
+	}
+
+	*c = PatchContents{}
+	return value.Decode(&c.Hex)
+}
+
+// MarshalJSON writes contents in the form they were specified within.
+func (c PatchContents) MarshalJSON() ([]byte, error) {
+	if c.Instructions != nil {
+		return json.Marshal(c.Instructions)
+	}
+
+	return json.Marshal(c.Hex)
+}
+
+// UnmarshalJSON permits contents to be either a string of hex or a list of instructions.
+func (c *PatchContents) UnmarshalJSON(contents []byte) error {
+	*c = PatchContents{}
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("[")) {
+		return json.Unmarshal(contents, &c.Instructions)
+	}
+
+	return json.Unmarshal(contents, &c.Hex)
+}
+
+// empty returns whether no contents were specified.
+func (c PatchContents) empty() bool {
+	return len(c.Instructions) == 0 && strings.TrimSpace(c.Hex) == ""
+}
+
+// bytes returns these contents, assembling instructions as located at the given address,
+// alongside the labels defined within them.
+func (c PatchContents) bytes(address uint32, resolve func(name string) (uint32, error)) ([]byte, Labels, error) {
+	if c.Instructions != nil {
+		return assemble(strings.Join(c.Instructions, "\n"), address, resolve)
+	}
+
+	contents, err := hex.DecodeString(strings.Join(strings.Fields(c.Hex), ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid hex \"%s\": %w", c.Hex, err)
+	}
+
+	return contents, nil, nil
+}
+
+// ParsePatchSetDefinition parses a patch set from YAML or JSON, ensuring it is valid.
+// Unknown fields are rejected, so that typos do not silently change how a patch applies.
+func ParsePatchSetDefinition(contents []byte) (PatchSetDefinition, error) {
+	var definition PatchSetDefinition
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&definition); err != nil {
+		return PatchSetDefinition{}, err
+	}
+
+	if err := definition.Validate(); err != nil {
+		return PatchSetDefinition{}, err
+	}
+
+	return definition, nil
+}
+
+// Validate ensures this patch set is well-formed: that it does not share its identifier or the names of its patches
+// with an available patch set, that each patch is located in a single manner, and that its contents are valid and
+// of equal length. As symbols are only resolved upon patching, those referenced within instructions are not verified.
+func (d PatchSetDefinition) Validate() error {
+	if d.ID == "" {
+		return &PatchDefinitionError{Err: errors.New("an identifier must be specified")}
+	}
+	if FindPatchSet(d.ID) != nil {
+		return &PatchDefinitionError{ID: d.ID, Err: errors.New("its identifier is that of an available patch set")}
+	}
+	if len(d.Patches) == 0 {
+		return &PatchDefinitionError{ID: d.ID, Err: errors.New("no patches are present")}
+	}
+
+	names := map[string]bool{}
+	for _, patch := range d.Patches {
+		if patch.Name == "" {
+			return &PatchDefinitionError{ID: d.ID, Err: errors.New("a patch has no name")}
+		}
+		if names[patch.Name] || PatchExists(patch.Name) {
+			return &PatchDefinitionError{d.ID, patch.Name, errors.New("its name is already in use")}
+		}
+		names[patch.Name] = true
+
+		// Any symbol resolves to the patch itself, so that only syntax and lengths are verified.
+		placeholder := func(string) (uint32, error) { return patch.Address, nil }
+		if _, err := patch.declare(patch.Address, placeholder); err != nil {
+			return &PatchDefinitionError{d.ID, patch.Name, err}
+		}
+	}
+
+	return nil
+}
+
+// declare returns this patch as declared, with instructions assembled as located at the given address.
+func (p PatchDefinition) declare(address uint32, resolve func(name string) (uint32, error)) (DOLPatch, error) {
+	if p.Offset != 0 && (p.Address != 0 || p.Symbol != "" || p.Signature != "") {
+		return DOLPatch{}, errors.New("an offset may not be combined with an address, symbol or signature")
+	}
+
+	var signature *Signature
+	if p.Signature != "" {
+		parsed, err := ParseSignature(p.Signature, p.SignatureOffset)
+		if err != nil {
+			return DOLPatch{}, err
+		}
+		signature = &parsed
+	}
+	if p.Before.empty() || p.After.empty() {
+		return DOLPatch{}, errors.New("both its original and replacement bytes must be specified")
+	}
+
+	// Our own labels take precedence, and every name referenced is permitted as a branch target.
+	labels := p.Labels.with(nil)
+	resolveLabel := func(name string) (uint32, error) {
+		if resolved, ok := p.Labels[name]; ok {
+			return resolved, nil
+		}
+
+		resolved, err := resolve(name)
+		if err == nil {
+			labels[name] = resolved
+		}
+		return resolved, err
+	}
+
+	before, _, err := p.Before.bytes(address, resolveLabel)
+	if err != nil {
+		return DOLPatch{}, fmt.Errorf("original bytes: %w", err)
+	}
+	after, defined, err := p.After.bytes(address, resolveLabel)
+	if err != nil {
+		return DOLPatch{}, fmt.Errorf("replacement bytes: %w", err)
+	}
+	if len(before) != len(after) {
+		return DOLPatch{}, fmt.Errorf("its original bytes are %d bytes long, but its replacement is %d", len(before), len(after))
+	}
+
+	// Without an address, relative branches cannot be computed.
+	if p.Offset != 0 || (p.Address == 0 && p.Symbol == "") {
+		if (p.Before.Instructions != nil && hasRelativeBranch(before)) || (p.After.Instructions != nil && hasRelativeBranch(after)) {
+			return DOLPatch{}, errors.New("relative branches require an address or symbol to be computed from")
+		}
+	}
+
+	return DOLPatch{
+		Name:      p.Name,
+		AtAddress: p.Address,
+		AtSymbol:  p.Symbol,
+		AtOffset:  int(p.Offset),
+		Signature: signature,
+		Before:    before,
+		After:     after,
+		DependsOn: p.DependsOn,
+		Labels:    labels.with(defined),
+	}, nil
+}
+
+// hasRelativeBranch returns whether the given instructions contain a relative branch.
+func hasRelativeBranch(contents []byte) bool {
+	for i := 0; i+4 <= len(contents); i += 4 {
+		opcode := contents[i] >> 2
+		absolute := contents[i+3]&2 != 0
+		if (opcode == 16 || opcode == 18) && !absolute {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Named returns this patch set as it is selected and created alongside those within AvailablePatchSets.
+// Symbols are resolved via the symbol map within the options it is created with.
+func (d PatchSetDefinition) Named() NamedPatchSet {
+	return NamedPatchSet{d.ID, func(options Options, _ *Allocator) (DOLPatchSet, error) {
+		name := d.Name
+		if name == "" {
+			name = d.ID
+		}
+
+		set := DOLPatchSet{Name: name}
+		for _, definition := range d.Patches {
+			address := definition.Address
+			if definition.Symbol != "" {
+				address = options.Symbols.AddressOr(definition.Symbol, address)
+			}
+
+			patch, err := definition.declare(address, options.Symbols.Resolve)
+			if err != nil {
+				return DOLPatchSet{}, &PatchDefinitionError{d.ID, definition.Name, err}
+			}
+			set.Patches = append(set.Patches, patch)
+		}
+
+		return set, nil
+	}}
+}
+
+// ValidateDefinitions ensures all given patch sets are valid,
+// and that none share an identifier or the names of their patches.
+func ValidateDefinitions(definitions []PatchSetDefinition) error {
+	ids := map[string]bool{}
+	names := map[string]bool{}
+	for _, definition := range definitions {
+		if err := definition.Validate(); err != nil {
+			return err
+		}
+
+		if ids[definition.ID] {
+			return &PatchDefinitionError{ID: definition.ID, Err: errors.New("its identifier is already in use")}
+		}
+		ids[definition.ID] = true
+
+		for _, patch := range definition.Patches {
+			if names[patch.Name] {
+				return &PatchDefinitionError{definition.ID, patch.Name, errors.New("its name is already in use")}
+			}
+			names[patch.Name] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,324 @@
+package patcher
+
+import (
+	. "github.com/wii-tools/powerpc"
+)
+
+// OverwriteIOSPatch effectively nullifies IOSC_VerifyPublicKeySign,
+// allocating space for its patch table and code via the given allocator.
+// See docs/patch_overwrite_ios.md for more information.
+func OverwriteIOSPatch(space *Allocator) (DOLPatchSet, error) {
+	patchTable, err := space.Allocate("the IOS patch table", uint32(len(iosPatchTable)), 4, false)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+
+	// Our function is assembled once its length is known, so that it may be placed.
+	labels := Labels{"PATCH_TABLE": patchTable}
+	length := len(MustAssemble(overwriteIOSMemorySource, 0, labels))
+	// It must be placed within reach of ipl::Exception::__ct, which branches to it.
+	overwriteIOSMemory, err := space.AllocateNear("overwriteIOSMemory", uint32(length), 4, true, 0x80017160, branchAlwaysReach)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+	code, defined, err := AssembleSource(overwriteIOSMemorySource, overwriteIOSMemory, labels, nil)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+	codeLabels := labels.with(defined)
+	handler := Labels{"overwriteIOSMemory": overwriteIOSMemory}
+
+	// ipl::Exception::__ct branches to overwriteIOSMemory wherever it was allocated.
+	branch, err := branchAlways(0x80017160, overwriteIOSMemory)
+	if err != nil {
+		return DOLPatchSet{}, err
+	}
+
+	return DOLPatchSet{
+		Name: "Overwrite IOS Syscall for ES",
+		Patches: []DOLPatch{
+			{
+				Name:      "Clear extraneous functions",
+				AtAddress: 0x800143f0,
+				AtSymbol:  "textinput::EventObserver::onOutOfLength",
+
+				Before: MustAssemble(`
+					textinput::EventObserver::onOutOfLength:
+						lis r3, 0x802f
+						addi r3, r3, 0x7ac4
+						crclr 6
+						b printf
+
+					textinput::EventObserver::onCancel:
+						lis r3, 0x802f
+						addi r3, r3, 0x7ab8
+						crclr 6
+						b printf
+
+					textinput::EventObserver::onOK:
+						subi r3, r13, 0x7fe0
+						crclr 6
+						b printf
+						.space 4
+
+					textinput::EventObserver::onSE:
+						blr
+						.space 12
+					textinput::EventObserver::onEvent:
+						blr
+						.space 12
+					textinput::EventObserver::onCommand:
+						blr
+						.space 12
+					textinput::EventObserver::onInput:
+						blr
+						.space 12
+				`, 0x800143f0, Labels{"printf": 0x802bcf74}),
+
+				// We wish to clear extraneous blrs so that our custom overwriteIOSMemory
+				// function does not somehow conflict.
+				// We only preserve onSE, which is this immediate blr.
+				After: MustAssemble(`
+					blr
+					.space 108
+				`, 0x800143f0, nil),
+			},
+			{
+				Name:      "Repair textinput::EventObserver vtable",
+				AtAddress: 0x802f7a9c,
+				AtSymbol:  "textinput::EventObserver::__vt+0x8",
+
+				Before: []byte{
+					0x80, 0x01, 0x44, 0x50, // onSE
+					0x80, 0x01, 0x44, 0x40, // onEvent
+					0x80, 0x01, 0x44, 0x30, // onCommand
+					0x80, 0x01, 0x44, 0x20, // onInput
+					0x80, 0x01, 0x44, 0x10, // onOK
+					0x80, 0x01, 0x44, 0x00, // onCancel
+					0x80, 0x01, 0x43, 0xf0, // onOutOfLength
+				},
+				After: []byte{
+					// These are all pointers to our so-called doNothing.
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+					0x80, 0x01, 0x43, 0xf0,
+				},
+			},
+			{
+				Name:      "Repair ipl::keyboard::EventObserver vtable",
+				AtAddress: 0x802f8420,
+				AtSymbol:  "ipl::keyboard::EventObserver::__vt+0x8",
+
+				Before: []byte{
+					0x80, 0x01, 0x44, 0x50, // textinput::EventObserver::onSE
+					0x80, 0x01, 0x84, 0xE0, // onCommand - not patched
+					0x80, 0x01, 0x44, 0x30, // textinput::EventObserver::onCommand
+					0x80, 0x01, 0x85, 0x20, // onSE - not patching
+					0x80, 0x01, 0x87, 0x40, // onOK - not patching
+					0x80, 0x01, 0x87, 0x60, // onCancel - not patching
+					0x80, 0x01, 0x43, 0xF0, // textinput::EventObserver::onOutOfLength
+				},
+				After: []byte{
+					0x80, 0x01, 0x43, 0xf0, // textinput::EventObserver::doNothing
+					0x80, 0x01, 0x84, 0xE0, // onCommand - not patched
+					0x80, 0x01, 0x43, 0xf0, // textinput::EventObserver::doNothing
+					0x80, 0x01, 0x85, 0x20, // onSE - not patching
+					0x80, 0x01, 0x87, 0x40, // onOK - not patching
+					0x80, 0x01, 0x87, 0x60, // onCancel - not patching
+					0x80, 0x01, 0x43, 0xf0, // textinput::EventObserver::doNothing
+				},
+			},
+			{
+				Name:      "Insert patch table",
+				AtAddress: patchTable,
+
+				Before: EmptyBytes(len(iosPatchTable)),
+				After:  iosPatchTable,
+			},
+			{
+				Name:      "Insert overwriteIOSMemory",
+				AtAddress: overwriteIOSMemory,
+
+				// This area should be cleared in the patch
+				// "Clear extraneous functions".
+				Before:    EmptyBytes(len(code)),
+				After:     code,
+				DependsOn: []string{"Clear extraneous functions"},
+				Labels:    codeLabels,
+			},
+			{
+				Name:      "Do not require input for exception handler",
+				AtAddress: 0x800171e0,
+				Before:    MustAssemble("stwu r1, -0x3f0(r1)", 0x800171e0, nil),
+				After:     MustAssemble("blr", 0x800171e0, nil),
+			},
+			{
+				Name:      "Modify ipl::Exception::__ct",
+				AtAddress: 0x80017160,
+
+				Before: MustAssemble("blr", 0x80017160, nil),
+				After: Instructions{
+					// bc 20, 0, overwriteIOSMemory
+					branch,
+				}.Bytes(),
+				Labels: handler,
+			},
+		},
+	}, nil
+}
+
+// iosPatchTable contains the address/value pairs overwriteIOSMemory writes.
+var iosPatchTable = []byte{
+	//////////////
+	// PATCH #1 //
+	//////////////
+	// We want to write to MEM_PROT at 0x0d8b420a.
+	// For us, this is mapped to 0xcd8b420a.
+	0xcd, 0x8b, 0x42, 0x0a,
+	// We are going to write the value 0x2 to unlock everything.
+	0x00, 0x00, 0x00, 0x02,
+
+	//////////////
+	// PATCH #2 //
+	//////////////
+	// We want to write to IOSC_VerifyPublicKeySign at 0x13a73ad4.
+	// For us, this is mapped to 0x92a73ad4.
+	0x93, 0xa7, 0x3a, 0xd4,
+	// 0x20004770 is equivalent in ARM THUMB to:
+	//    mov r0, #0x0
+	//    bx lr
+	0x20, 0x00, 0x47, 0x70,
+
+	// Not a patch! This is here so we have shorter assembly.
+	// 0xcd8005a0 is the location of LT_CHIPREVID.
+	0xcd, 0x80, 0x05, 0xa0,
+	// We're attempting to compare 0xcafe.
+	0x00, 0x00, 0xca, 0xfe,
+
+	//////////////////////////
+	// PATCH #3 - vWii only //
+	//////////////////////////
+	// Patch location:
+	// We want to write at 0x20102100, aka "ES_AddTicket".
+	// We use the address mapped to PowerPC.
+	0x93, 0x9f, 0x21, 0x00,
+	// The original code has a few conditionals preventing system title usage.
+	// We simply branch off past these.
+	// 0x681ae008 is equivalent in ARM THUMB to:
+	//    ldr r2,[r3,#0x0]     ; original code we wish to preserve
+	//                         ; so we can write 32 bits
+	//    b +0x14              ; branch past conditionals
+	0x68, 0x1a, 0xe0, 0x08,
+
+	//////////////////////////
+	// PATCH #4 - vWii only //
+	//////////////////////////
+	// We want to write to 0x20103240, aka "ES_AddTitleStart".
+	// We use the address mapped to PowerPC.
+	0x93, 0x9f, 0x32, 0x40,
+	// The original code has a few conditionals preventing system title usage.
+	// 0xe00846c0 is equivalent in ARM THUMB to:
+	//    b +0x8       ; branch past conditionals
+	//    add sp,#0x0  ; recommended THUMB nop
+	0xe0, 0x08, 0xb0, 0x00,
+
+	//////////////////////////
+	// PATCH #5 - vWii only //
+	//////////////////////////
+	// Lastly, we want to write to 0x20103564, aka "ES_AddContentStart".
+	// We use the address mapped to PowerPC.
+	0x93, 0x9f, 0x35, 0x64,
+	// The original code has a few conditionals preventing system title usage.
+	// We simply branch off past these.
+	// 0xe00c46c0 is equivalent in ARM THUMB to:
+	//    b +0xc       ; branch past conditionals
+	//    add sp,#0x0  ; recommended THUMB nop
+	0xe0, 0x0c, 0xb0, 0x00,
+
+	// This is additionally not a patch!
+	// We use this to store our ideal MEM2 mapping.
+	0x93, 0x00, 0x01, 0xff,
+}
+
+// overwriteIOSMemorySource is our function applying the patch table at PATCH_TABLE to IOS memory.
+const overwriteIOSMemorySource = `
+	# Load the address of our patch table.
+	lis r8, PATCH_TABLE@h
+	ori r8, r8, PATCH_TABLE@l
+
+	# Load address/value pair for MEM_PROT
+	lwz r9, 0x0(r8)
+	lwz r10, 0x4(r8)
+	# Apply lower half
+	sth r10, 0x0(r9)
+
+	# Load a better mapping for upper MEM2.
+	lwz r9, 0x30(r8)
+	mtspr dbat7u, r9
+
+	# Load address/value pair for IOSC_VerifyPublicKeySign
+	lwz r9, 0x8(r8)
+	lwz r10, 0xc(r8)
+	# Apply!
+	stw r10, 0x0(r9)
+
+	# The remainder of our patches are for a Wii U. We must detect such.
+	# Even in vWii mode, 0x0d8005a0 (LT_CHIPREVID) will have its upper
+	# 16 bits set to 0xCAFE. We can compare against this.
+	# See also: https://wiiubrew.org/wiki/Hardware/Latte_registers
+	# (However, we must access the cached version at 0xcd8005a0.)
+	lwz r9, 0x10(r8)
+	lwz r9, 0x0(r9)
+	sync
+
+	# Shift this value 16 bits to the right
+	# in order to compare its higher value.
+	rlwinm r9, r9, 0x10, 0x10, 0x1f
+
+	# Load 0xcafe, our comparison value
+	lwz r10, 0x14(r8)
+
+	# Compare!
+	cmpw r9, r10
+
+	# If we're not a Wii U, carry on until the end.
+	bne FINISHED
+
+	# Apply ES_AddTicket
+	lwz r9, 0x18(r8)
+	lwz r10, 0x1c(r8)
+	stw r10, 0x0(r9)
+
+	# Apply ES_AddTitleStart
+	lwz r9, 0x20(r8)
+	lwz r10, 0x24(r8)
+	stw r10, 0x0(r9)
+
+	# Apply ES_AddContentStart
+	lwz r9, 0x28(r8)
+	lwz r10, 0x2c(r8)
+	stw r10, 0x0(r9)
+
+FINISHED:
+	# We're finished patching!
+	blr
+`
+
+// branchAlwaysReach is the distance a target of branchAlways must lie within.
+const branchAlwaysReach = 0x8000
+
+// branchAlways returns "bc 20, 0, target" from the given address, as Nintendo utilizes
+// within ipl::Exception::__ct. Its displacement is limited to 16 bits, so the target must lie within 32 KiB.
+func branchAlways(current uint32, target uint32) (Instruction, error) {
+	displacement := int64(target) - int64(current)
+	if displacement < -0x8000 || displacement >= 0x8000 {
+		return Instruction{}, &BranchRangeError{current, target}
+	}
+
+	word := uint32(displacement) & 0xfffc
+	return Instruction{0x42, 0x80, byte(word >> 8), byte(word)}, nil
+}
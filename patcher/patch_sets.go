@@ -0,0 +1,119 @@
+package patcher
+
+// NamedPatchSet associates an identifier with a patch set.
+type NamedPatchSet struct {
+	// ID is utilized to reference this patch set within options and profiles.
+	ID string
+
+	// Set returns this patch set. As some patch sets depend on the base domain,
+	// root certificate, symbols, or free space, they are created upon usage.
+	Set func(options Options, space *Allocator) (DOLPatchSet, error)
+}
+
+// AvailablePatchSets contains all patch sets able to be applied to the main DOL, in their default order.
+var AvailablePatchSets = []NamedPatchSet{
+	{"overwrite_ios", func(_ Options, space *Allocator) (DOLPatchSet, error) {
+		return OverwriteIOSPatch(space)
+	}},
+	{"custom_ca", func(options Options, space *Allocator) (DOLPatchSet, error) {
+		return LoadCustomCA(options.RootCertificate, options.Symbols, space)
+	}},
+	{"base_domain", func(options Options, _ *Allocator) (DOLPatchSet, error) {
+		return PatchBaseDomain(options.BaseDomain), nil
+	}},
+	{"ec_title_check", func(Options, *Allocator) (DOLPatchSet, error) { return NegateECTitle, nil }},
+	{"ec_cfg_path", func(Options, *Allocator) (DOLPatchSet, error) { return PatchECCfgPath, nil }},
+}
+
+// DefaultPatchSets returns the identifiers of all available patch sets.
+func DefaultPatchSets() []string {
+	var ids []string
+	for _, set := range AvailablePatchSets {
+		ids = append(ids, set.ID)
+	}
+
+	return ids
+}
+
+// FindPatchSet returns the patch set with the given identifier, or nil if none exist.
+func FindPatchSet(id string) *NamedPatchSet {
+	for i := range AvailablePatchSets {
+		if AvailablePatchSets[i].ID == id {
+			return &AvailablePatchSets[i]
+		}
+	}
+
+	return nil
+}
+
+// findPatchSet returns the patch set with the given identifier within AvailablePatchSets or the given definitions,
+// or nil if none exist.
+func findPatchSet(id string, definitions []PatchSetDefinition) *NamedPatchSet {
+	if named := FindPatchSet(id); named != nil {
+		return named
+	}
+
+	for _, definition := range definitions {
+		if definition.ID == id {
+			named := definition.Named()
+			return &named
+		}
+	}
+
+	return nil
+}
+
+// Describe returns this patch set as created with default options,
+// permitting its name and patches to be listed without a WAD.
+func (n NamedPatchSet) Describe() (DOLPatchSet, error) {
+	return n.Set(Options{}, NewAllocator(FindVersion(ShopTitleVersion).FreeRegions))
+}
+
+// PatchExists returns whether a patch with the given name is present within any patch set.
+func PatchExists(name string) bool {
+	for _, named := range AvailablePatchSets {
+		set, err := named.Describe()
+		if err != nil {
+			continue
+		}
+
+		for _, patch := range set.Patches {
+			if patch.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// definedPatchExists returns whether a patch with the given name is present within any of the given definitions.
+func definedPatchExists(name string, definitions []PatchSetDefinition) bool {
+	for _, definition := range definitions {
+		for _, patch := range definition.Patches {
+			if patch.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ValidateSelection ensures all patch sets and patches referenced exist, either as available patch sets
+// or within the given definitions loaded from files, so that we fail prior to patching.
+func ValidateSelection(patchSets []string, disabledPatches []string, definitions []PatchSetDefinition) error {
+	for _, id := range patchSets {
+		if findPatchSet(id, definitions) == nil {
+			return &UnknownPatchSetError{id}
+		}
+	}
+
+	for _, name := range disabledPatches {
+		if !PatchExists(name) && !definedPatchExists(name, definitions) {
+			return &UnknownPatchError{name}
+		}
+	}
+
+	return nil
+}
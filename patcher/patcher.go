@@ -0,0 +1,582 @@
+// Package patcher applies the Open Shop Channel's modifications to the Wii Shop Channel,
+// permitting it to connect to a custom base domain with a custom root certificate.
+package patcher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/arclib"
+	"github.com/wii-tools/powerpc"
+	"github.com/wii-tools/wadlib"
+	"io"
+)
+
+// MaxCertificateLength is the amount of free space available for our root certificate.
+// See docs/patch_custom_ca_ios.md for more information.
+const MaxCertificateLength = 928
+
+// MaxAppendedCertificateLength is the largest root certificate permitted when a data section is appended.
+// Its length is loaded via a signed 16-bit immediate within NHTTPi_SocSSLConnect.
+const MaxAppendedCertificateLength = 0x7fff
+
+// Options describes how a WAD should be patched.
+type Options struct {
+	// BaseDomain is the domain to replace shop.wii.com with, up to 12 characters.
+	BaseDomain string
+
+	// RootCertificate is the root certificate to patch in, in DER form.
+	RootCertificate []byte
+
+	// ServerCertificate is the server certificate issued alongside RootCertificate, in DER form.
+	// It is optional, and only utilized to describe it within our report.
+	ServerCertificate []byte
+
+	// PatchSets lists the identifiers of patch sets to apply, in order.
+	// If nil, all patch sets within AvailablePatchSets are applied.
+	PatchSets []string
+
+	// DisabledPatches lists the names of individual patches to skip
+	// within the patch sets above.
+	DisabledPatches []string
+
+	// Filter describes entries within Opera's myfilter.ini.
+	// Both file:/cnt/* and our base domain are always permitted.
+	Filter Filter
+
+	// AccessRights is the value of the TMD's access rights flags.
+	// If nil, it is set to 0x3 when OverwriteIOSPatch is applied,
+	// permitting r/w access to MEM2_PROT. Otherwise, it is left as-is.
+	AccessRights *uint32
+
+	// PatchSetDefinitions contains patch sets loaded from files, selectable alongside those within AvailablePatchSets.
+	// If PatchSets is nil, they are applied after all available patch sets.
+	PatchSetDefinitions []PatchSetDefinition
+
+	// AllowUnknownDOL permits main DOLs not known for their revision, such as those already modified,
+	// logging a warning rather than failing. Patches still verify their original bytes upon applying.
+	AllowUnknownDOL bool
+
+	// Sections describes new sections appended to the main DOL, providing space for
+	// injected code and data beyond that free within the original DOL.
+	Sections Sections
+
+	// Symbols resolves symbols referenced by patches, such as branch targets.
+	// If nil, the symbol map within the WAD's main ARC is used, if present.
+	Symbols *SymbolMap
+
+	// Log receives progress as patches are applied. If nil, nothing is logged.
+	// Patchers used concurrently should not share a writer unless it is safe to do so.
+	Log io.Writer
+}
+
+// Sections describes new sections appended to the main DOL for patch payloads.
+// If both sizes are zero, no sections are appended.
+type Sections struct {
+	// TextSize is the length of a new text section, which may contain code.
+	TextSize uint32 `yaml:"text_size" json:"text_size"`
+
+	// DataSize is the length of a new data section, which may contain data such as our root certificate.
+	DataSize uint32 `yaml:"data_size" json:"data_size"`
+
+	// Address is the virtual address the new text section begins at, with the data section following.
+	// If zero, they are placed at __ArenaLo, the start of the arena. Either way, they must reside within MEM1,
+	// and __ArenaLo is raised past them if necessary so that the arena does not overlap them.
+	Address uint32 `yaml:"address" json:"address"`
+}
+
+// Enabled returns whether any sections are to be appended.
+func (s Sections) Enabled() bool {
+	return s.TextSize != 0 || s.DataSize != 0
+}
+
+// MaxCertificateLength returns the largest root certificate permitted with these sections:
+// the largest of that free within the main DOL, and the appended data section's size up to MaxAppendedCertificateLength.
+func (s Sections) MaxCertificateLength() int {
+	appended := int(s.DataSize)
+	if appended > MaxAppendedCertificateLength {
+		appended = MaxAppendedCertificateLength
+	}
+	if appended < MaxCertificateLength {
+		return MaxCertificateLength
+	}
+
+	return appended
+}
+
+// Filter describes entries added to Opera's filter list.
+type Filter struct {
+	// Include lists additional URL patterns Opera may load.
+	Include []string `yaml:"include" json:"include"`
+
+	// Exclude lists URL patterns Opera may not load.
+	Exclude []string `yaml:"exclude" json:"exclude"`
+}
+
+// DefaultFilter returns the filter utilized by the Open Shop Channel.
+func DefaultFilter() Filter {
+	return Filter{
+		Include: []string{
+			"http://*.oscwii.org/*",
+			"https://*.oscwii.org/*",
+			"miip:*",
+		},
+		Exclude: []string{
+			"*",
+		},
+	}
+}
+
+// Patcher applies patches to the Wii Shop Channel as described by its options.
+// It holds no state beyond its options, and is safe for concurrent use;
+// any amount of patchers may run concurrently within a single process.
+type Patcher struct {
+	options Options
+}
+
+// New returns a patcher for the given options, ensuring they are valid.
+// A root certificate is only required upon patching.
+// Options are copied, so that they may be reused or modified afterwards.
+func New(options Options) (*Patcher, error) {
+	if options.BaseDomain == "" {
+		return nil, ErrMissingBaseDomain
+	}
+
+	if len(options.BaseDomain) > len(NintendoBaseDomain) {
+		return nil, ErrBaseDomainTooLong
+	}
+
+	if maximum := options.Sections.MaxCertificateLength(); len(options.RootCertificate) > maximum {
+		return nil, &CertificateTooLargeError{len(options.RootCertificate), maximum}
+	}
+
+	options.RootCertificate = cloneBytes(options.RootCertificate)
+	options.ServerCertificate = cloneBytes(options.ServerCertificate)
+	options.PatchSets = cloneStrings(options.PatchSets)
+	options.DisabledPatches = cloneStrings(options.DisabledPatches)
+	options.Filter = Filter{cloneStrings(options.Filter.Include), cloneStrings(options.Filter.Exclude)}
+	if options.AccessRights != nil {
+		accessRights := *options.AccessRights
+		options.AccessRights = &accessRights
+	}
+
+	options.PatchSetDefinitions = append([]PatchSetDefinition(nil), options.PatchSetDefinitions...)
+	err := ValidateDefinitions(options.PatchSetDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.PatchSets == nil {
+		options.PatchSets = DefaultPatchSets()
+		for _, definition := range options.PatchSetDefinitions {
+			options.PatchSets = append(options.PatchSets, definition.ID)
+		}
+	}
+
+	err = ValidateSelection(options.PatchSets, options.DisabledPatches, options.PatchSetDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Patcher{options}, nil
+}
+
+// Symbols returns the symbol map utilized for the given WAD: that within our options if present,
+// or otherwise that within its main ARC. If neither are available, nil is returned.
+func (p *Patcher) Symbols(wad *wadlib.WAD) (*SymbolMap, error) {
+	if p.options.Symbols != nil {
+		return p.options.Symbols, nil
+	}
+
+	return LoadSymbols(wad)
+}
+
+// PatchSets returns all patch sets selected by our options, with offsets within the given revision's main DOL,
+// omitting any individually disabled patches. The given symbol map may be nil.
+// Patches are ensured not to conflict with one another, as described by CheckConflicts,
+// and their branches are ensured to target declared labels, as described by CheckBranches.
+// The main DOL these offsets apply to is returned alongside, with any sections requested by our options appended.
+// The given DOL is not modified.
+func (p *Patcher) PatchSets(version *ShopVersion, dol []byte, symbols *SymbolMap) ([]powerpc.PatchSet, []byte, error) {
+	sets, dol, err := p.declaredSets(version, dol, symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	relocated, err := version.Relocate(sets, dol, symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Both checks rely upon where each patch writes, which is costly to compute.
+	ranges := PatchRanges(sets, relocated, dol)
+	err = CheckConflicts(sets, ranges)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = CheckBranches(sets, ranges, dol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return relocated, dol, nil
+}
+
+// declaredSets returns all patch sets selected by our options as declared, omitting any individually disabled patches,
+// alongside the given main DOL with any sections requested by our options appended.
+func (p *Patcher) declaredSets(version *ShopVersion, dol []byte, symbols *SymbolMap) ([]DOLPatchSet, []byte, error) {
+	options := p.options
+	options.Symbols = symbols
+
+	dol, appended, reservation, err := p.appendSections(dol, symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+	space := NewAllocator(append(p.freeRegions(version), appended...))
+
+	var sets []DOLPatchSet
+	for _, id := range options.PatchSets {
+		set, err := findPatchSet(id, options.PatchSetDefinitions).Set(options, space)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var patches []DOLPatch
+		for _, patch := range set.Patches {
+			if !p.patchDisabled(patch.Name) {
+				patches = append(patches, patch)
+			}
+		}
+		set.Patches = patches
+
+		sets = append(sets, set)
+	}
+
+	// Our sections are reserved after all other patches, so that their patches apply as declared.
+	if len(reservation) != 0 {
+		sets = append(sets, DOLPatchSet{Name: "Reserve appended sections", Patches: reservation})
+	}
+
+	return sets, dol, nil
+}
+
+// appendSections returns the given main DOL with the sections requested by our options appended,
+// alongside free regions describing them and patches raising __ArenaLo to reserve them from the arena.
+// If no sections are requested, the DOL is returned as-is.
+func (p *Patcher) appendSections(dol []byte, symbols *SymbolMap) ([]byte, []FreeRegion, []DOLPatch, error) {
+	sections := p.options.Sections
+	if !sections.Enabled() {
+		return dol, nil, nil, nil
+	}
+
+	layout, err := ParseDOL(dol)
+	if err != nil {
+		return nil, nil, nil, &InvalidWADError{err}
+	}
+
+	// By default, sections are placed at the start of the arena.
+	// Otherwise, they must not overlap the stacks between the BSS and arena.
+	arenaLo := arenaLoAddress(layout, symbols)
+	address := sections.Address
+	if address == 0 {
+		address = arenaLo
+	}
+	size := alignUp(sections.TextSize, dolSectionAlignment) + alignUp(sections.DataSize, dolSectionAlignment)
+	if address < arenaLo && alignUp(address, dolSectionAlignment)+size > layout.End() {
+		return nil, nil, nil, ErrSectionWithinStack
+	}
+
+	// __ArenaLo is raised past our sections, and so may already be within a patched DOL.
+	raised := alignUp(address, dolSectionAlignment) + size
+	loads := findArenaLoads(dol, layout, arenaLo, raised)
+	if raised > arenaLo && len(loads) == 0 {
+		return nil, nil, nil, ErrArenaLoNotFound
+	}
+
+	original := dol
+	var regions []FreeRegion
+	for _, requested := range []struct {
+		isText bool
+		size   uint32
+	}{{true, sections.TextSize}, {false, sections.DataSize}} {
+		if requested.size == 0 {
+			continue
+		}
+
+		var section DOLSection
+		dol, section, err = AppendSection(dol, requested.isText, address, requested.size)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to append %s section: %w", sectionKind(requested.isText), err)
+		}
+
+		regions = append(regions, FreeRegion{
+			Name:       fmt.Sprintf("appended %s section", sectionKind(requested.isText)),
+			Address:    section.Address,
+			Size:       section.Size,
+			Executable: section.IsText,
+		})
+		address = section.Address + section.Size
+	}
+
+	if raised <= arenaLo {
+		return dol, regions, nil, nil
+	}
+
+	return dol, regions, raiseArenaLo(original, layout, loads, arenaLo, raised), nil
+}
+
+// sectionKind describes whether a section contains text or data.
+func sectionKind(isText bool) string {
+	if isText {
+		return "text"
+	}
+
+	return "data"
+}
+
+// freeRegions returns the free regions of the given revision available to our patches,
+// omitting those freed by a disabled patch.
+func (p *Patcher) freeRegions(version *ShopVersion) []FreeRegion {
+	var regions []FreeRegion
+	for _, region := range version.FreeRegions {
+		if region.FreedBy == "" || !p.patchDisabled(region.FreedBy) {
+			regions = append(regions, region)
+		}
+	}
+
+	return regions
+}
+
+// availablePatchSets returns all patch sets within AvailablePatchSets, followed by those loaded from files.
+func (p *Patcher) availablePatchSets() []NamedPatchSet {
+	sets := append([]NamedPatchSet{}, AvailablePatchSets...)
+	for _, definition := range p.options.PatchSetDefinitions {
+		sets = append(sets, definition.Named())
+	}
+
+	return sets
+}
+
+// patchSetEnabled returns whether the patch set with the given identifier is selected.
+func (p *Patcher) patchSetEnabled(id string) bool {
+	for _, enabled := range p.options.PatchSets {
+		if enabled == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patchDisabled returns whether the patch with the given name is disabled.
+func (p *Patcher) patchDisabled(name string) bool {
+	for _, disabled := range p.options.DisabledPatches {
+		if disabled == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AccessRights returns the TMD access rights flags to apply, given the original flags.
+func (p *Patcher) AccessRights(original uint32) uint32 {
+	if p.options.AccessRights != nil {
+		return *p.options.AccessRights
+	}
+
+	// Permit r/w access to MEM2_PROT if we are overwriting IOS.
+	// See docs/patch_overwrite_ios.md for more information!
+	if p.patchSetEnabled("overwrite_ios") {
+		return 0x3
+	}
+
+	return original
+}
+
+// Version returns the supported revision of the given WAD, as identified via its main DOL by IdentifyVersion.
+// If permitted by our options, an unknown main DOL is accepted with a warning logged.
+func (p *Patcher) Version(wad *wadlib.WAD, dol []byte) (*ShopVersion, error) {
+	version, err := IdentifyVersion(wad.TMD.TitleVersion, dol)
+	var unknown *UnknownDOLError
+	if !errors.As(err, &unknown) || !p.options.AllowUnknownDOL {
+		return version, err
+	}
+
+	fmt.Fprintln(logWriter(p.options.Log), aurora.Yellow(fmt.Sprintf("Warning: %v. Patches are verified against their original bytes alone.", err)))
+	return FindVersion(wad.TMD.TitleVersion), nil
+}
+
+// Filter returns the complete filter written to Opera's myfilter.ini.
+func (p *Patcher) Filter() Filter {
+	return FilterWithBaseDomain(p.options.Filter, p.options.BaseDomain)
+}
+
+// Patch applies all DOL and Opera patches to the given WAD,
+// returning the patched WAD alongside a report describing all changes.
+// The given WAD is not modified, and may be shared between concurrent calls.
+func (p *Patcher) Patch(original []byte) ([]byte, *BuildReport, error) {
+	return p.patch(original, true)
+}
+
+// patch applies all patches to the given WAD as with Patch. If preserve is false, no restoration is recorded,
+// as its contents are not known to be original, and the patched WAD cannot be restored by Unpatch.
+func (p *Patcher) patch(original []byte, preserve bool) ([]byte, *BuildReport, error) {
+	if len(p.options.RootCertificate) == 0 {
+		return nil, nil, ErrMissingRootCertificate
+	}
+
+	log := logWriter(p.options.Log)
+	wad, err := LoadWAD(cloneBytes(original))
+	if err != nil {
+		return nil, nil, err
+	}
+	if recordsRestoration(wad) {
+		return nil, nil, ErrAlreadyPatched
+	}
+
+	// Describe our input prior to any modifications.
+	report := &BuildReport{}
+	report.Input, err = DescribeWAD(wad, original)
+	if err != nil {
+		return nil, nil, &InvalidWADError{err}
+	}
+	report.Certificates, err = p.describeCertificates()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Load main DOL
+	mainDol, err := wad.GetContent(1)
+	if err != nil {
+		return nil, nil, &InvalidWADError{err}
+	}
+
+	// Retain what is necessary to restore the original WAD.
+	originalAccessRights := wad.TMD.AccessRightsFlags
+	originalDol := cloneBytes(mainDol)
+
+	// Permit r/w access to MEM2_PROT via the TMD if necessary.
+	wad.TMD.AccessRightsFlags = p.AccessRights(wad.TMD.AccessRightsFlags)
+	report.AccessRights = wad.TMD.AccessRightsFlags
+
+	// Determine offsets for this revision
+	version, err := p.Version(wad, mainDol)
+	if err != nil {
+		return nil, nil, err
+	}
+	symbols, err := p.Symbols(wad)
+	if err != nil {
+		return nil, nil, err
+	}
+	sets, mainDol, err := p.PatchSets(version, mainDol, symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Apply all DOL patches
+	fmt.Fprintln(log, aurora.Green("Applying DOL patches..."))
+	report.PatchSets, err = ApplySets(sets, mainDol, log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Save main DOL
+	err = wad.UpdateContent(1, mainDol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Load main ARC
+	arcData, err := wad.GetContent(2)
+	if err != nil {
+		return nil, nil, &InvalidWADError{err}
+	}
+	mainArc, err := arclib.Load(arcData)
+	if err != nil {
+		return nil, nil, &InvalidWADError{err}
+	}
+
+	// Record how our patches were applied so that this WAD may be unpatched.
+	if preserve {
+		restoration, err := p.restoration(originalAccessRights, originalDol, arcData, mainArc, report.PatchSets)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = recordRestoration(mainArc, restoration)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Generate filter list and certificate store
+	fmt.Fprintln(log, aurora.Green("Applying Opera patches..."))
+	report.Filter = p.Filter()
+	err = modifyARC(mainArc, report.Filter, p.options.RootCertificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Save main ARC
+	updated, err := mainArc.Save()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = wad.UpdateContent(2, updated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generate a patched WAD with our changes
+	output, err := wad.GetWAD(wadlib.WADTypeCommon)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report.Output, err = DescribeWAD(wad, output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, report, nil
+}
+
+// describeCertificates returns reports for our root certificate,
+// and our server certificate if one was specified.
+func (p *Patcher) describeCertificates() ([]CertificateReport, error) {
+	root, err := DescribeCertificate("root", p.options.RootCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []CertificateReport{root}
+	if p.options.ServerCertificate == nil {
+		return reports, nil
+	}
+
+	server, err := DescribeCertificate("server", p.options.ServerCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(reports, server), nil
+}
+
+// cloneBytes returns a copy of the given bytes, retaining nil.
+func cloneBytes(contents []byte) []byte {
+	if contents == nil {
+		return nil
+	}
+
+	return append([]byte{}, contents...)
+}
+
+// cloneStrings returns a copy of the given strings, retaining nil.
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+
+	return append([]string{}, values...)
+}
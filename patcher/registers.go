@@ -0,0 +1,61 @@
+package patcher
+
+import (
+	"fmt"
+)
+
+// sprNames maps special-purpose register numbers to their names.
+var sprNames = map[uint32]string{
+	1:    "xer",
+	8:    "lr",
+	9:    "ctr",
+	18:   "dsisr",
+	19:   "dar",
+	22:   "dec",
+	25:   "sdr1",
+	26:   "srr0",
+	27:   "srr1",
+	268:  "tbl",
+	269:  "tbu",
+	272:  "sprg0",
+	273:  "sprg1",
+	274:  "sprg2",
+	275:  "sprg3",
+	287:  "pvr",
+	920:  "hid2",
+	921:  "wpar",
+	922:  "dma_u",
+	923:  "dma_l",
+	1008: "hid0",
+	1009: "hid1",
+	1010: "iabr",
+	1013: "dabr",
+	1017: "l2cr",
+}
+
+func init() {
+	// Batch registers are sequential pairs of upper and lower halves.
+	// Broadway additionally has four more sets of both.
+	for i := uint32(0); i < 4; i++ {
+		sprNames[528+i*2] = fmt.Sprintf("ibat%du", i)
+		sprNames[529+i*2] = fmt.Sprintf("ibat%dl", i)
+		sprNames[536+i*2] = fmt.Sprintf("dbat%du", i)
+		sprNames[537+i*2] = fmt.Sprintf("dbat%dl", i)
+		sprNames[560+i*2] = fmt.Sprintf("ibat%du", i+4)
+		sprNames[561+i*2] = fmt.Sprintf("ibat%dl", i+4)
+		sprNames[568+i*2] = fmt.Sprintf("dbat%du", i+4)
+		sprNames[569+i*2] = fmt.Sprintf("dbat%dl", i+4)
+	}
+
+	// Graphics quantization registers are utilized by paired singles.
+	for i := uint32(0); i < 8; i++ {
+		sprNames[912+i] = fmt.Sprintf("gqr%d", i)
+	}
+}
+
+// conditionNames are the simplified names of each bit within a condition register field,
+// for both when a branch is taken on the bit being set, and the bit being clear.
+var (
+	conditionTrue  = [4]string{"lt", "gt", "eq", "so"}
+	conditionFalse = [4]string{"ge", "le", "ne", "ns"}
+)
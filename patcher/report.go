@@ -0,0 +1,129 @@
+package patcher
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"github.com/wii-tools/wadlib"
+	"time"
+)
+
+// BuildReport describes everything that occurred within a patch run,
+// suitable for archival and comparison between builds.
+type BuildReport struct {
+	// Input describes the original WAD.
+	Input WADReport `json:"input"`
+
+	// AccessRights is the TMD's access rights flags after patching.
+	AccessRights uint32 `json:"access_rights"`
+
+	// PatchSets lists all patch sets applied to the main DOL.
+	PatchSets []PatchSetReport `json:"patch_sets"`
+
+	// Certificates lists the root certificate, and server certificate if present.
+	Certificates []CertificateReport `json:"certificates"`
+
+	// Filter lists the entries within Opera's filter list.
+	Filter Filter `json:"filter"`
+
+	// Output describes the patched WAD.
+	Output WADReport `json:"output"`
+}
+
+// WADReport describes a WAD and its contents.
+type WADReport struct {
+	// Path is where this WAD was read from or written to, if known.
+	Path string `json:"path,omitempty"`
+
+	TitleID      string `json:"title_id"`
+	TitleVersion uint16 `json:"title_version"`
+
+	// SHA256 is the hash of the entire WAD.
+	SHA256 string `json:"sha256"`
+
+	// Contents lists hashes of each decrypted content.
+	Contents []ContentReport `json:"contents"`
+}
+
+// ContentReport describes a single content within a WAD.
+type ContentReport struct {
+	Index  uint16 `json:"index"`
+	ID     string `json:"id"`
+	Size   int    `json:"size"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+}
+
+// PatchSetReport describes a patch set applied to the main DOL.
+type PatchSetReport struct {
+	Name    string        `json:"name"`
+	Patches []PatchReport `json:"patches"`
+}
+
+// PatchReport describes a single patch applied to the main DOL.
+type PatchReport struct {
+	Name string `json:"name"`
+
+	// Offsets lists every file offset this patch was applied at.
+	// Patches without a specified offset may apply to many, or none.
+	Offsets []int `json:"offsets"`
+
+	// Length is the amount of bytes replaced at each offset.
+	Length int `json:"length"`
+}
+
+// CertificateReport describes a certificate utilized within this build.
+type CertificateReport struct {
+	// Role is either "root" or "server".
+	Role      string    `json:"role"`
+	Subject   string    `json:"subject"`
+	SHA1      string    `json:"sha1"`
+	SHA256    string    `json:"sha256"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// DescribeWAD returns a report describing the given WAD and its contents,
+// alongside the hash of its serialized form.
+func DescribeWAD(wad *wadlib.WAD, serialized []byte) (WADReport, error) {
+	described := WADReport{
+		TitleID:      fmt.Sprintf("%016x", wad.TMD.TitleID),
+		TitleVersion: wad.TMD.TitleVersion,
+		SHA256:       fmt.Sprintf("%x", sha256.Sum256(serialized)),
+	}
+
+	for _, record := range wad.TMD.Contents {
+		contents, err := wad.GetContent(int(record.Index))
+		if err != nil {
+			return WADReport{}, err
+		}
+
+		described.Contents = append(described.Contents, ContentReport{
+			Index:  record.Index,
+			ID:     fmt.Sprintf("%08x", record.ID),
+			Size:   len(contents),
+			SHA1:   fmt.Sprintf("%x", sha1.Sum(contents)),
+			SHA256: fmt.Sprintf("%x", sha256.Sum256(contents)),
+		})
+	}
+
+	return described, nil
+}
+
+// DescribeCertificate returns a report describing the given certificate, in DER form.
+func DescribeCertificate(role string, contents []byte) (CertificateReport, error) {
+	cert, err := x509.ParseCertificate(contents)
+	if err != nil {
+		return CertificateReport{}, err
+	}
+
+	return CertificateReport{
+		Role:      role,
+		Subject:   cert.Subject.String(),
+		SHA1:      fmt.Sprintf("%x", sha1.Sum(contents)),
+		SHA256:    fmt.Sprintf("%x", sha256.Sum256(contents)),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}, nil
+}
@@ -0,0 +1,315 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/arclib"
+	"github.com/wii-tools/powerpc"
+	"github.com/wii-tools/wadlib"
+	"io"
+	"path"
+)
+
+const (
+	// RestorationPath is the directory within the main ARC our restoration is recorded within.
+	RestorationPath = "arc/wsc-patcher"
+
+	// restorationName is the name of the file describing our restoration within RestorationPath.
+	restorationName = "restoration.json"
+)
+
+var (
+	ErrNotRestorable  = errors.New("the WAD does not record a restoration, and was either not patched or patched by an older version of WSC-Patcher")
+	ErrAlreadyPatched = errors.New("the WAD has already been patched by WSC-Patcher")
+)
+
+// replacedFiles lists the files within the main ARC we replace entirely, whose original contents are recorded.
+var replacedFiles = []string{OperaFilterPath, OperaCertStorePath}
+
+// Restoration describes how a patched WAD is restored to its original state.
+// It is recorded within the main ARC, permitting patches from files and appended sections to be reverted.
+// DOL patches are reverted via their original bytes, and so are not preserved. The Opera files we replace
+// entirely are preserved within Files.
+type Restoration struct {
+	// BaseDomain, RootCertificate, PatchSets, DisabledPatches, Sections and PatchSetDefinitions
+	// are the options the WAD was patched with, permitting patches to be reproduced.
+	BaseDomain          string               `json:"base_domain"`
+	RootCertificate     []byte               `json:"root_certificate"`
+	PatchSets           []string             `json:"patch_sets"`
+	DisabledPatches     []string             `json:"disabled_patches"`
+	Sections            Sections             `json:"sections"`
+	PatchSetDefinitions []PatchSetDefinition `json:"patch_set_definitions,omitempty"`
+
+	// AccessRights is the TMD's original access rights flags.
+	AccessRights uint32 `json:"access_rights"`
+
+	// DOLSize is the length of the original main DOL, prior to appending any sections.
+	DOLSize int `json:"dol_size"`
+
+	// DOLHash and ARCHash are the SHA-1 hashes of the original main DOL and ARC,
+	// verified once restored.
+	DOLHash string `json:"dol_sha1"`
+	ARCHash string `json:"arc_sha1"`
+
+	// Files contains the original contents of every file within the main ARC we replace, keyed by their path.
+	Files map[string][]byte `json:"files"`
+
+	// Applied lists where all patches were applied within the main DOL.
+	Applied []PatchSetReport `json:"applied"`
+}
+
+// restoration returns a restoration for the given original main DOL and ARC, given the TMD's original
+// access rights and where our patches were applied. The ARC's files must not yet be replaced.
+func (p *Patcher) restoration(accessRights uint32, dol []byte, arcData []byte, arc *arclib.ARC, applied []PatchSetReport) (Restoration, error) {
+	files := map[string][]byte{}
+	for _, replaced := range replacedFiles {
+		contents, err := arc.ReadFile(replaced)
+		if err != nil {
+			return Restoration{}, &ARCFileMissingError{replaced, err}
+		}
+
+		files[replaced] = contents
+	}
+
+	return Restoration{
+		BaseDomain:          p.options.BaseDomain,
+		RootCertificate:     p.options.RootCertificate,
+		PatchSets:           p.options.PatchSets,
+		DisabledPatches:     p.options.DisabledPatches,
+		Sections:            p.options.Sections,
+		PatchSetDefinitions: p.options.PatchSetDefinitions,
+		AccessRights:        accessRights,
+		DOLSize:             len(dol),
+		DOLHash:             fmt.Sprintf("%x", sha1.Sum(dol)),
+		ARCHash:             fmt.Sprintf("%x", sha1.Sum(arcData)),
+		Files:               files,
+		Applied:             applied,
+	}, nil
+}
+
+// recordRestoration stores the given restoration within the given ARC.
+func recordRestoration(arc *arclib.ARC, restoration Restoration) error {
+	described, err := json.Marshal(restoration)
+	if err != nil {
+		return err
+	}
+
+	recorded := arclib.ARCDir{
+		Filename: path.Base(RestorationPath),
+	}
+	recorded.WriteFile(restorationName, described)
+
+	parent, err := arc.OpenDir(path.Dir(RestorationPath))
+	if err != nil {
+		return &ARCFileMissingError{path.Dir(RestorationPath), err}
+	}
+
+	parent.AddDir(recorded)
+	return nil
+}
+
+// LoadRestoration returns the restoration recorded within the given main ARC.
+// If none is present, ErrNotRestorable is returned.
+func LoadRestoration(arc *arclib.ARC) (*Restoration, error) {
+	contents, err := arc.ReadFile(path.Join(RestorationPath, restorationName))
+	if err != nil {
+		return nil, ErrNotRestorable
+	}
+
+	var restoration Restoration
+	err = json.Unmarshal(contents, &restoration)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", restorationName, err)
+	}
+
+	return &restoration, nil
+}
+
+// recordsRestoration returns whether the given WAD's main ARC records a restoration.
+// WADs whose main ARC cannot be loaded are reported as not, so that loading it fails as usual.
+func recordsRestoration(wad *wadlib.WAD) bool {
+	arcData, err := wad.GetContent(2)
+	if err != nil {
+		return false
+	}
+	mainArc, err := arclib.Load(arcData)
+	if err != nil {
+		return false
+	}
+
+	_, err = LoadRestoration(mainArc)
+	return err == nil
+}
+
+// removeRestoration removes our restoration from the given ARC.
+func removeRestoration(arc *arclib.ARC) error {
+	parent, err := arc.OpenDir(path.Dir(RestorationPath))
+	if err != nil {
+		return &ARCFileMissingError{path.Dir(RestorationPath), err}
+	}
+
+	var subdirs []arclib.ARCDir
+	for _, subdir := range parent.Subdirs {
+		if subdir.Filename != path.Base(RestorationPath) {
+			subdirs = append(subdirs, subdir)
+		}
+	}
+	parent.Subdirs = subdirs
+
+	return nil
+}
+
+// RevertSets reverts the given patch sets within the binary in place, in the reverse order of their application.
+// Each patch is reverted at the offsets listed within the given reports, which must describe the same sets.
+// If log is nil, nothing is logged.
+func RevertSets(sets []DOLPatchSet, applied []PatchSetReport, binary []byte, log io.Writer) error {
+	log = logWriter(log)
+	if len(sets) != len(applied) {
+		return fmt.Errorf("expected %d applied patch sets, but %d were recorded", len(sets), len(applied))
+	}
+
+	for i := len(sets) - 1; i >= 0; i-- {
+		set, setReport := sets[i], applied[i]
+		if set.Name != setReport.Name || len(set.Patches) != len(setReport.Patches) {
+			return fmt.Errorf("patch set \"%s\" does not match the recorded patch set \"%s\"", set.Name, setReport.Name)
+		}
+
+		fmt.Fprintf(log, "Reverting patch set \"%s\":\n", aurora.Yellow(set.Name))
+		for j := len(set.Patches) - 1; j >= 0; j-- {
+			patch, report := set.Patches[j], setReport.Patches[j]
+			if patch.Name != report.Name {
+				return fmt.Errorf("patch \"%s\" does not match the recorded patch \"%s\"", patch.Name, report.Name)
+			}
+
+			fmt.Fprintln(log, " + Reverting patch", aurora.Cyan(patch.Name))
+			for _, offset := range report.Offsets {
+				end := offset + len(patch.After)
+				if end > len(binary) || !bytes.Equal(binary[offset:end], patch.After) {
+					return &PatchError{set.Name, patch.Name, offset, powerpc.ErrInvalidPatch}
+				}
+
+				copy(binary[offset:], patch.Before)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Unpatch restores a WAD patched by Patch to its original contents, without needing the original WAD.
+// DOL patches are reproduced from the options recorded within its restoration and reverted via their original bytes,
+// and appended sections removed. The original Opera files and TMD access rights are then restored from the restoration.
+// The restored main DOL and ARC are verified against the hashes of the originals. WADs without a restoration,
+// such as those patched by earlier versions of WSC-Patcher, cannot be restored, and ErrNotRestorable is returned.
+// The given symbol map may be nil, as with Options. If log is nil, nothing is logged.
+func Unpatch(patched []byte, symbols *SymbolMap, log io.Writer) ([]byte, error) {
+	wad, err := LoadWAD(cloneBytes(patched))
+	if err != nil {
+		return nil, err
+	}
+
+	arcData, err := wad.GetContent(2)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	mainArc, err := arclib.Load(arcData)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	restoration, err := LoadRestoration(mainArc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = revertRestoration(wad, restoration, symbols, log)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(logWriter(log), aurora.Green("Restoring Opera files..."))
+	for _, replaced := range replacedFiles {
+		contents, ok := restoration.Files[replaced]
+		if !ok {
+			return nil, fmt.Errorf("the restoration does not contain the original %s", replaced)
+		}
+
+		err = mainArc.WriteFile(replaced, contents)
+		if err != nil {
+			return nil, &ARCFileMissingError{replaced, err}
+		}
+	}
+	err = removeRestoration(mainArc)
+	if err != nil {
+		return nil, err
+	}
+	restoredArc, err := mainArc.Save()
+	if err != nil {
+		return nil, err
+	}
+	if hash := fmt.Sprintf("%x", sha1.Sum(restoredArc)); hash != restoration.ARCHash {
+		return nil, &RestorationError{"main ARC", restoration.ARCHash, hash}
+	}
+
+	wad.TMD.AccessRightsFlags = restoration.AccessRights
+	err = wad.UpdateContent(2, restoredArc)
+	if err != nil {
+		return nil, err
+	}
+
+	return wad.GetWAD(wadlib.WADTypeCommon)
+}
+
+// revertRestoration reverts all patches within the given WAD's main DOL as described by the given restoration,
+// removing any appended sections, and updates the WAD with the original main DOL once verified against its hash.
+func revertRestoration(wad *wadlib.WAD, restoration *Restoration, symbols *SymbolMap, log io.Writer) error {
+	p, err := New(Options{
+		BaseDomain:          restoration.BaseDomain,
+		RootCertificate:     restoration.RootCertificate,
+		PatchSets:           restoration.PatchSets,
+		DisabledPatches:     restoration.DisabledPatches,
+		Sections:            restoration.Sections,
+		PatchSetDefinitions: restoration.PatchSetDefinitions,
+		Symbols:             symbols,
+		Log:                 log,
+	})
+	if err != nil {
+		return err
+	}
+	symbols, err = p.Symbols(wad)
+	if err != nil {
+		return err
+	}
+
+	// Reproduce our patches against the DOL's original layout.
+	mainDol, err := wad.GetContent(1)
+	if err != nil {
+		return &InvalidWADError{err}
+	}
+	layout, err := TruncateSections(mainDol, restoration.DOLSize)
+	if err != nil {
+		return &InvalidWADError{err}
+	}
+	sets, _, err := p.declaredSets(FindVersion(wad.TMD.TitleVersion), layout, symbols)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(logWriter(log), aurora.Green("Reverting DOL patches..."))
+	err = RevertSets(sets, restoration.Applied, mainDol, log)
+	if err != nil {
+		return err
+	}
+	mainDol, err = TruncateSections(mainDol, restoration.DOLSize)
+	if err != nil {
+		return &InvalidWADError{err}
+	}
+	if hash := fmt.Sprintf("%x", sha1.Sum(mainDol)); hash != restoration.DOLHash {
+		return &RestorationError{"main DOL", restoration.DOLHash, hash}
+	}
+
+	return wad.UpdateContent(1, mainDol)
+}
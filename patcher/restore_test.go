@@ -0,0 +1,94 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"testing"
+)
+
+func TestUnpatchRestoresOriginal(t *testing.T) {
+	original := testWAD(t, testDOL(t), testARC(t, []byte("[include]\r\nhttps://*.shop.wii.com/*\r\n"), []byte{0, 0, 0x10, 0, 5, 5, 0, 0x23, 0, 1, 0, 4}))
+
+	tests := []struct {
+		name     string
+		sections Sections
+		retarget bool
+	}{
+		{"recorded", Sections{}, false},
+		{"recorded with appended sections", Sections{TextSize: 0x100, DataSize: 0x1000}, false},
+		// Retargeting restores the WAD beforehand, so that its restoration describes the original.
+		{"retargeted", Sections{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := New(Options{
+				BaseDomain:      "a.taur.cloud",
+				RootCertificate: testCertificate(t),
+				PatchSets:       DefaultPatchSets(),
+				Sections:        test.sections,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, _, err := p.Patch(original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(patched, original) {
+				t.Fatal("patching did not modify the WAD")
+			}
+
+			if test.retarget {
+				retargeter, err := New(Options{
+					BaseDomain:      "b.taur.cloud",
+					RootCertificate: testCertificate(t),
+					PatchSets:       DefaultPatchSets(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				patched, _, err = retargeter.Retarget(patched)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restored, err := Unpatch(patched, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(restored, original) {
+				t.Fatalf("restored WAD has SHA-1 %x, whereas the original had %x", sha1.Sum(restored), sha1.Sum(original))
+			}
+		})
+	}
+}
+
+func TestUnpatchRequiresRestoration(t *testing.T) {
+	original := testWAD(t, testDOL(t), testARC(t, []byte("[include]\r\n"), []byte{0, 0, 0x10, 0}))
+	p, err := New(Options{
+		BaseDomain:      "a.taur.cloud",
+		RootCertificate: testCertificate(t),
+		PatchSets:       DefaultPatchSets(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a restoration, the original Opera files are not known.
+	unrecorded, _, err := p.patch(original, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, wad := range map[string][]byte{"unpatched": original, "unrecorded": unrecorded} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Unpatch(wad, nil, nil)
+			if err != ErrNotRestorable {
+				t.Fatalf("expected %v, but received %v", ErrNotRestorable, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package patcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/logrusorgru/aurora/v3"
+	"github.com/wii-tools/powerpc"
+	"github.com/wii-tools/wadlib"
+)
+
+// Retarget applies our patches to the given WAD, which may have been previously patched with another
+// base domain or root certificate, returning the patched WAD alongside a report describing all changes.
+// The original WAD is not required: if the given WAD records a restoration, it is first restored via Unpatch.
+// Otherwise, its existing base domain and root certificate are determined from its main DOL and all patches reverted,
+// after which its Opera files are generated anew. As its original Opera files and access rights are then unknown,
+// no restoration is recorded.
+// WADs that were never patched are patched as-is.
+func (p *Patcher) Retarget(patched []byte) ([]byte, *BuildReport, error) {
+	wad, err := LoadWAD(cloneBytes(patched))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if recordsRestoration(wad) {
+		original, err := Unpatch(patched, p.options.Symbols, p.options.Log)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return p.Patch(original)
+	}
+
+	changed, err := p.revertEmbedded(wad)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !changed {
+		return p.Patch(patched)
+	}
+
+	original, err := wad.GetWAD(wadlib.WADTypeCommon)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fmt.Fprintln(logWriter(p.options.Log), aurora.Yellow("Warning: the WAD does not record a restoration, so neither will the result, and it cannot be unpatched."))
+	return p.patch(original, false)
+}
+
+// revertEmbedded reverts all patches within the given WAD's main DOL in place, as determined by
+// the base domain and root certificate embedded within it, returning whether any patches were present.
+// The reverted DOL is verified to contain the original bytes of every patch.
+func (p *Patcher) revertEmbedded(wad *wadlib.WAD) (bool, error) {
+	log := logWriter(p.options.Log)
+	mainDol, err := wad.GetContent(1)
+	if err != nil {
+		return false, &InvalidWADError{err}
+	}
+	layout, err := ParseDOL(mainDol)
+	if err != nil {
+		return false, &InvalidWADError{err}
+	}
+	symbols, err := p.Symbols(wad)
+	if err != nil {
+		return false, err
+	}
+
+	version := FindVersion(wad.TMD.TitleVersion)
+	existing := Options{
+		BaseDomain:      embeddedBaseDomain(version, layout, mainDol, symbols),
+		RootCertificate: embeddedCertificate(version, layout, mainDol, symbols),
+		PatchSets:       DefaultPatchSets(),
+	}
+	if existing.BaseDomain == "" {
+		return false, errors.New("unable to determine the base domain within the main DOL")
+	}
+
+	_, located, err := locatePatches(version, existing, len(mainDol), mainDol, layout, symbols)
+	if err != nil {
+		return false, err
+	}
+
+	// Determine the state of every patch prior to reverting any, as patches may overlap.
+	states := make([]PatchState, len(located))
+	changed := false
+	for i := range located {
+		states[i] = patchState(located, i, mainDol)
+		if states[i] == PatchApplied || states[i] == PatchPartial {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	fmt.Fprintln(log, aurora.Green(fmt.Sprintf("Reverting patches for %s...", existing.BaseDomain)))
+	for i := len(located) - 1; i >= 0; i-- {
+		current := located[i]
+		switch states[i] {
+		case PatchOriginal:
+			continue
+		case PatchApplied, PatchPartial:
+		default:
+			return false, &PatchError{current.setName, current.patch.Name, current.offset, powerpc.ErrInvalidPatch}
+		}
+
+		fmt.Fprintln(log, " + Reverting patch", aurora.Cyan(current.patch.Name))
+		if current.found {
+			copy(mainDol[current.offset:], current.patch.Before)
+			continue
+		}
+
+		// Patches located by searching are reverted wherever present.
+		if bytes.Equal(current.patch.Before, current.patch.After) {
+			continue
+		}
+		if len(current.patch.Before) != len(current.patch.After) {
+			return false, &PatchError{current.setName, current.patch.Name, 0, powerpc.ErrInconsistentPatch}
+		}
+		for offset := bytes.Index(mainDol, current.patch.After); offset != -1; offset = bytes.Index(mainDol, current.patch.After) {
+			copy(mainDol[offset:], current.patch.Before)
+		}
+	}
+
+	for i, current := range located {
+		if current.found && patchState(located, i, mainDol) != PatchOriginal {
+			return false, &PatchError{current.setName, current.patch.Name, current.offset, powerpc.ErrInvalidPatch}
+		}
+	}
+
+	err = wad.UpdateContent(1, mainDol)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,183 @@
+package patcher
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Signature locates a patch by searching for the bytes surrounding it,
+// permitting it to be found within main DOLs its offset is not known for.
+type Signature struct {
+	// Pattern contains the bytes to search for.
+	Pattern []byte
+
+	// Mask specifies which bits within Pattern must match, and is the same length.
+	// If nil, all bits must match.
+	Mask []byte
+
+	// Offset is the distance from the start of Pattern to the patch.
+	Offset int
+}
+
+// Signatures maps the names of patches to signatures able to locate them.
+// They are utilized when a patch's offset is not known for a revision,
+// or when its original bytes are not present at its defined offset.
+// A patch's own DOLPatch.Signature takes precedence, as returned by its signature method.
+//
+// Instruction signatures mask fields that differ between builds, such as branch displacements
+// and the halves of addresses. Functions whose prolog alone is ambiguous are anchored to a distinctive
+// neighbour at a fixed distance. A patch's original bytes must still match where its signature locates it,
+// so patches calling other functions, such as NHTTPi_SocSSLConnect, apply only if their calls are unchanged.
+var Signatures = map[string]Signature{
+	// Strings are terminated so that we only match them in full.
+	// The trusted domain prefix is also the suffix of other hosts, so its preceding terminator is matched as well.
+	"Modify oss-auth URL":               {Pattern: []byte(GetLogURL + "\x00")},
+	"Modify trusted base domain prefix": {Pattern: []byte("\x00" + TrustedDomain + "\x00"), Offset: 1},
+	"Modify ECS SOAP endpoint URL":      {Pattern: []byte(ECommerceBaseURL + "\x00")},
+	"Rename ec.cfg to osc.cfg":          {Pattern: []byte("ec.cfg\x00\x00")},
+
+	// lwz r4, 0xc0(r28); cmpwi r4, 0; beq; lwz r3, 0xac(r28); lwz r5, 0xc4(r28); bl SSLSetRootCA; cmpwi r3, 0; beq; li r3, -1004; b
+	"Modify NHTTPi_SocSSLConnect to load cert": MustParseSignature("80 9c 00 c0 2c 04 00 00 41 82 ?? ?? 80 7c 00 ac 80 bc 00 c4 4? ?? ?? ?? "+
+		"2c 03 00 00 41 82 ?? ?? 38 60 fc 14 4? ?? ?? ??", 0),
+
+	// The prologs of ec::allowDownloadByApp and ec::isManagedTicket, 0x100 bytes apart,
+	// followed by that of ec::isManagedTitle 0x2f0 bytes later.
+	"Permit downloading all titles": MustParseSignature(ecTitlePrologs, 0),
+	"Mark all tickets as managed":   MustParseSignature(ecTitlePrologs, 0x100),
+	"Mark all titles as managed":    MustParseSignature(ecTitlePrologs, 0x3f0),
+
+	// Nothing distinctive is known near ec::removeAllTitles, so its prolog is likely ambiguous
+	// within other builds; such a signature is rejected rather than applied at the first match.
+	"Nullify ec::removeAllTitles": MustParseSignature("94 21 ff c0 7c 08 02 a6", 0),
+
+	// Three methods loading a string and tail-calling printf, followed by the blr of onSE.
+	"Clear extraneous functions": MustParseSignature("3c 60 ?? ?? 38 63 ?? ?? 4c c6 31 82 4? ?? ?? ?? "+
+		"3c 60 ?? ?? 38 63 ?? ?? 4c c6 31 82 4? ?? ?? ?? 38 6d ?? ?? 4c c6 31 82 4? ?? ?? ??", 0),
+
+	// The blr within ipl::Exception::__ct precedes the unusually large stack frame of our exception handler.
+	"Modify ipl::Exception::__ct":                MustParseSignature(exceptionHandlers, 0),
+	"Do not require input for exception handler": MustParseSignature(exceptionHandlers, 0x80),
+}
+
+// ecTitlePrologs matches the prologs of the functions patched by NegateECTitle, which are otherwise ambiguous.
+var ecTitlePrologs = "94 21 ff e0 7c 08 02 a6" + wildcards(0xf8) + "94 21 ff f0 7c 08 02 a6" + wildcards(0x2e8) + "94 21 ff f0 7c 08 02 a6"
+
+// exceptionHandlers matches the blr within ipl::Exception::__ct and the prolog of the exception handler following it.
+var exceptionHandlers = "4e 80 00 20" + wildcards(0x7c) + "94 21 fc 10"
+
+// wildcards returns a signature matching the given amount of arbitrary bytes,
+// permitting signatures to anchor a patch to distinctive instructions nearby.
+func wildcards(length int) string {
+	return strings.Repeat(" ??", length) + " "
+}
+
+// ParseSignature parses a signature from hex bytes separated by spaces, where "?"
+// represents a wildcard nibble. For example, "7c 08 02 a6 ?? ?? ?? ?? 4? 82"
+// matches mflr r0, followed by any instruction, followed by a conditional branch.
+// The given offset is the distance from the start of the signature to the patch.
+func ParseSignature(signature string, offset int) (Signature, error) {
+	parsed := Signature{Offset: offset}
+
+	for _, field := range strings.Fields(signature) {
+		if len(field) != 2 {
+			return Signature{}, fmt.Errorf("invalid signature byte \"%s\"", field)
+		}
+
+		// Wildcard nibbles are zeroed within both our pattern and mask.
+		value := strings.ReplaceAll(field, "?", "0")
+		mask := ""
+		for _, nibble := range field {
+			if nibble == '?' {
+				mask += "0"
+			} else {
+				mask += "f"
+			}
+		}
+
+		patternByte, err := strconv.ParseUint(value, 16, 8)
+		if err != nil {
+			return Signature{}, fmt.Errorf("invalid signature byte \"%s\"", field)
+		}
+		maskByte, _ := strconv.ParseUint(mask, 16, 8)
+
+		parsed.Pattern = append(parsed.Pattern, byte(patternByte))
+		parsed.Mask = append(parsed.Mask, byte(maskByte))
+	}
+
+	if len(parsed.Pattern) == 0 {
+		return Signature{}, fmt.Errorf("signature is empty")
+	}
+
+	return parsed, nil
+}
+
+// MustParseSignature is similar to ParseSignature, but panics upon error.
+// It is intended for signatures defined within code.
+func MustParseSignature(signature string, offset int) Signature {
+	parsed, err := ParseSignature(signature, offset)
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+// matchesAt returns whether this signature matches the binary at the given offset.
+func (s Signature) matchesAt(binary []byte, offset int) bool {
+	if offset < 0 || offset+len(s.Pattern) > len(binary) {
+		return false
+	}
+
+	if s.Mask == nil {
+		return bytes.Equal(binary[offset:offset+len(s.Pattern)], s.Pattern)
+	}
+
+	for i, expected := range s.Pattern {
+		if binary[offset+i]&s.Mask[i] != expected&s.Mask[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Find returns the offsets of all patches this signature matches within the binary.
+// Its mask, if any, must be the same length as its pattern.
+func (s Signature) Find(binary []byte) []int {
+	offsets := []int{}
+	for start := 0; start+len(s.Pattern) <= len(binary); start++ {
+		if s.matchesAt(binary, start) {
+			offsets = append(offsets, start+s.Offset)
+		}
+	}
+
+	return offsets
+}
+
+// Locate returns the offset of the patch this signature matches within the binary,
+// ensuring it matches exactly once.
+func (s Signature) Locate(binary []byte) (int, error) {
+	if s.Mask != nil && len(s.Mask) != len(s.Pattern) {
+		return 0, ErrInvalidSignature
+	}
+
+	offsets := s.Find(binary)
+	if len(offsets) != 1 {
+		return 0, &SignatureError{Matches: len(offsets)}
+	}
+
+	return offsets[0], nil
+}
+
+// signature returns the signature able to locate this patch, if any:
+// its own, and otherwise that within Signatures.
+func (p DOLPatch) signature() (Signature, bool) {
+	if p.Signature != nil {
+		return *p.Signature, true
+	}
+
+	signature, ok := Signatures[p.Name]
+	return signature, ok
+}
@@ -0,0 +1,441 @@
+package patcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/wii-tools/arclib"
+)
+
+// PatchState describes which bytes are present where a patch applies.
+type PatchState string
+
+const (
+	// PatchOriginal represents a patch's original bytes being present.
+	PatchOriginal PatchState = "original"
+
+	// PatchApplied represents a patch's replacement bytes being present.
+	PatchApplied PatchState = "patched"
+
+	// PatchPartial represents a patch located by searching being present at some locations, but not all.
+	PatchPartial PatchState = "partial"
+
+	// PatchModified represents neither a patch's original nor replacement bytes being present.
+	PatchModified PatchState = "modified"
+
+	// PatchUnknown represents a patch that could not be located.
+	PatchUnknown PatchState = "unknown"
+)
+
+// StatusReport describes which of our patches are present within a WAD, and what it has been patched with.
+type StatusReport struct {
+	TitleVersion uint16 `json:"title_version"`
+	AccessRights uint32 `json:"access_rights"`
+
+	// BaseDomain is the base domain present within the main DOL, or empty if it could not be determined.
+	BaseDomain string `json:"base_domain"`
+
+	// Restorable is whether a restoration is recorded, permitting Unpatch.
+	Restorable bool `json:"restorable"`
+
+	// IOSCertificate describes the root certificate loaded into IOS, if present.
+	IOSCertificate *CertificateReport `json:"ios_certificate"`
+
+	// OperaCertificates describes all certificates within Opera's cert store.
+	OperaCertificates []CertificateReport `json:"opera_certificates"`
+
+	// Filter lists the entries within Opera's filter list.
+	Filter Filter `json:"filter"`
+
+	// PatchSets describes the state of every available patch set, and those the WAD was patched with from files.
+	PatchSets []PatchSetStatus `json:"patch_sets"`
+}
+
+// PatchSetStatus describes the state of all patches within a patch set.
+type PatchSetStatus struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Patches []PatchStatus `json:"patches"`
+}
+
+// PatchStatus describes the state of a single patch.
+type PatchStatus struct {
+	Name  string     `json:"name"`
+	State PatchState `json:"state"`
+
+	// Offset is the file offset this patch applies at, or zero if located by searching.
+	Offset int `json:"offset"`
+}
+
+// Status returns which of our patches are present within the given Shop WAD, alongside the base domain,
+// certificates and filter list it contains. Options the WAD was patched with are read from its restoration
+// if present, and otherwise determined from its main DOL. The given symbol map may be nil, as with Options.
+func Status(contents []byte, symbols *SymbolMap) (*StatusReport, error) {
+	wad, err := LoadWAD(cloneBytes(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	mainDol, err := wad.GetContent(1)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	layout, err := ParseDOL(mainDol)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	arcData, err := wad.GetContent(2)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	mainArc, err := arclib.Load(arcData)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+
+	if symbols == nil {
+		symbols, err = LoadSymbols(wad)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	version := FindVersion(wad.TMD.TitleVersion)
+	report := &StatusReport{
+		TitleVersion: wad.TMD.TitleVersion,
+		AccessRights: wad.TMD.AccessRightsFlags,
+	}
+
+	// Determine what this WAD was patched with.
+	options := Options{
+		PatchSets: DefaultPatchSets(),
+	}
+	dolSize := len(mainDol)
+	restoration, err := LoadRestoration(mainArc)
+	if err == nil {
+		report.Restorable = true
+		options.BaseDomain = restoration.BaseDomain
+		options.RootCertificate = restoration.RootCertificate
+		options.PatchSets = restoration.PatchSets
+		options.DisabledPatches = restoration.DisabledPatches
+		options.Sections = restoration.Sections
+		options.PatchSetDefinitions = restoration.PatchSetDefinitions
+		dolSize = restoration.DOLSize
+	} else {
+		options.BaseDomain = embeddedBaseDomain(version, layout, mainDol, symbols)
+		options.RootCertificate = embeddedCertificate(version, layout, mainDol, symbols)
+	}
+	report.BaseDomain = options.BaseDomain
+
+	if options.RootCertificate != nil {
+		described, err := DescribeCertificate("root", options.RootCertificate)
+		if err == nil {
+			report.IOSCertificate = &described
+		}
+	}
+
+	report.PatchSets, err = patchStatus(version, options, dolSize, mainDol, layout, symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opera's files may not be as we generate them, so their absence is not an error.
+	if store, err := mainArc.ReadFile(OperaCertStorePath); err == nil {
+		certificates, _ := ParseOperaCertStore(store)
+		for _, certificate := range certificates {
+			described, err := DescribeCertificate("opera", certificate)
+			if err == nil {
+				report.OperaCertificates = append(report.OperaCertificates, described)
+			}
+		}
+	}
+	if filter, err := mainArc.ReadFile(OperaFilterPath); err == nil {
+		report.Filter = ParseFilter(filter)
+	}
+
+	return report, nil
+}
+
+// patchStatus returns the state of all available patch sets within the given main DOL, as created with the given options.
+// The DOL's original size is utilized to reproduce any sections appended to it.
+func patchStatus(version *ShopVersion, options Options, dolSize int, dol []byte, layout *DOL, symbols *SymbolMap) ([]PatchSetStatus, error) {
+	statuses, located, err := locatePatches(version, options, dolSize, dol, layout, symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, current := range located {
+		status := &statuses[current.set]
+		status.Patches = append(status.Patches, PatchStatus{
+			Name:   current.patch.Name,
+			State:  patchState(located, i, dol),
+			Offset: current.offset,
+		})
+	}
+
+	return statuses, nil
+}
+
+// locatePatches returns all available patch sets as created with the given options, without their patches,
+// alongside all patches within them located within the given main DOL in order of application.
+// Selected patch sets are created in their selected order, omitting space freed by disabled patches,
+// so that allocations match those patched. All others follow within space of their own.
+func locatePatches(version *ShopVersion, options Options, dolSize int, dol []byte, layout *DOL, symbols *SymbolMap) ([]PatchSetStatus, []locatedPatch, error) {
+	// Our domain is only absent if the DOL is not one we recognize.
+	if options.BaseDomain == "" {
+		options.BaseDomain = NintendoBaseDomain
+	}
+	options.Symbols = symbols
+
+	// Reproduce sections as they were appended, so that allocations match.
+	p := &Patcher{options}
+	var regions []FreeRegion
+	if original, err := TruncateSections(dol, dolSize); err == nil {
+		_, regions, _, _ = p.appendSections(original, symbols)
+	}
+	space := NewAllocator(append(p.freeRegions(version), regions...))
+
+	// Patch sets that are not selected are shown as they would apply, regardless of any disabled patches.
+	unselected := NewAllocator(append(append([]FreeRegion{}, version.FreeRegions...), regions...))
+
+	// Statuses remain in the order patch sets are available.
+	available := p.availablePatchSets()
+	statuses := make([]PatchSetStatus, len(available))
+	var selected, order []int
+	for i, named := range available {
+		statuses[i].ID = named.ID
+		if !p.patchSetEnabled(named.ID) {
+			order = append(order, i)
+		}
+	}
+	for _, id := range options.PatchSets {
+		for i, named := range available {
+			if named.ID == id {
+				selected = append(selected, i)
+			}
+		}
+	}
+	order = append(selected, order...)
+
+	var located []locatedPatch
+	for _, index := range order {
+		named := available[index]
+		allocator := space
+		if !p.patchSetEnabled(named.ID) {
+			allocator = unselected
+		}
+
+		set, err := named.Set(options, allocator)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		statuses[index].Name = set.Name
+		for _, patch := range set.Patches {
+			offset, found := version.statusOffset(set, patch, layout, dol, symbols)
+			located = append(located, locatedPatch{index, set.Name, patch, offset, found})
+		}
+	}
+
+	return statuses, located, nil
+}
+
+// locatedPatch represents a patch alongside the offset it applies at, for usage within patchState.
+type locatedPatch struct {
+	// set and setName are the index and name of the patch set containing this patch.
+	set     int
+	setName string
+
+	patch  DOLPatch
+	offset int
+
+	// found is whether an offset could be determined. Patches located by searching have none.
+	found bool
+}
+
+// statusOffset returns the offset of the given patch within the given main DOL, and whether it could be determined.
+// Patches are located as with Relocate, except that their replacement bytes are additionally permitted.
+// Patches located by searching have no offset.
+func (v *ShopVersion) statusOffset(set DOLPatchSet, patch DOLPatch, layout *DOL, dol []byte, symbols *SymbolMap) (int, bool) {
+	if patch.AtOffset != 0 {
+		return patch.AtOffset, true
+	}
+
+	if patch.AtAddress == 0 && patch.AtSymbol == "" && patch.Signature == nil {
+		return 0, false
+	}
+
+	if offset, ok := v.Offsets[patch.Name]; ok {
+		return offset, true
+	}
+
+	offsets, _ := v.candidates(set, patch, layout, symbols)
+	if signature, ok := patch.signature(); ok {
+		if offset, err := signature.Locate(dol); err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) == 0 {
+		return 0, false
+	}
+
+	for _, offset := range offsets {
+		if offset <= len(dol) && (bytes.HasPrefix(dol[offset:], patch.Before) || bytes.HasPrefix(dol[offset:], patch.After)) {
+			return offset, true
+		}
+	}
+
+	return offsets[0], true
+}
+
+// patchState returns the state of the patch at the given index within the given main DOL.
+// Patches overlapping others they depend upon are compared against their dependencies' original bytes,
+// and patches overlapped by others depending upon them against their dependents' replacement bytes.
+func patchState(located []locatedPatch, index int, dol []byte) PatchState {
+	current := located[index]
+	if !current.found && (current.patch.AtAddress != 0 || current.patch.AtSymbol != "" || current.patch.Signature != nil) {
+		return PatchUnknown
+	}
+
+	if !current.found {
+		original := bytes.Count(dol, current.patch.Before)
+		replaced := bytes.Count(dol, current.patch.After)
+		switch {
+		case original != 0 && replaced != 0 && !bytes.Equal(current.patch.Before, current.patch.After):
+			return PatchPartial
+		case original != 0:
+			return PatchOriginal
+		case replaced != 0:
+			return PatchApplied
+		default:
+			return PatchModified
+		}
+	}
+
+	before := cloneBytes(current.patch.Before)
+	after := cloneBytes(current.patch.After)
+	for i, other := range located {
+		if !other.found {
+			continue
+		}
+
+		if i < index && dependsOn(current.patch, other.patch.Name) {
+			overlay(before, current.offset, other.patch.Before, other.offset)
+		}
+		if i > index && dependsOn(other.patch, current.patch.Name) {
+			overlay(after, current.offset, other.patch.After, other.offset)
+		}
+	}
+
+	if current.offset > len(dol) {
+		return PatchModified
+	}
+	switch {
+	case bytes.HasPrefix(dol[current.offset:], before):
+		return PatchOriginal
+	case bytes.HasPrefix(dol[current.offset:], after):
+		return PatchApplied
+	default:
+		return PatchModified
+	}
+}
+
+// dependsOn returns whether the given patch declares a dependency upon the patch with the given name.
+func dependsOn(patch DOLPatch, name string) bool {
+	for _, dependency := range patch.DependsOn {
+		if dependency == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overlay copies the portion of other, beginning at otherOffset, overlapping contents beginning at offset.
+func overlay(contents []byte, offset int, other []byte, otherOffset int) {
+	start, end := otherOffset, otherOffset+len(other)
+	if start < offset {
+		start = offset
+	}
+	if end > offset+len(contents) {
+		end = offset + len(contents)
+	}
+
+	if start < end {
+		copy(contents[start-offset:end-offset], other[start-otherOffset:end-otherOffset])
+	}
+}
+
+// embeddedBaseDomain returns the base domain present within the trusted base domain prefix of the given main DOL,
+// or an empty string if it could not be located.
+func embeddedBaseDomain(version *ShopVersion, layout *DOL, dol []byte, symbols *SymbolMap) string {
+	patch, _ := findPatch(PatchBaseDomain(NintendoBaseDomain), "Modify trusted base domain prefix")
+	offset, ok := embeddedOffset(version, patch, layout, symbols)
+	if !ok || offset+len(TrustedDomain) > len(dol) {
+		return ""
+	}
+
+	prefix := bytes.TrimRight(dol[offset:offset+len(TrustedDomain)], "\x00")
+	if !bytes.HasPrefix(prefix, []byte(".")) || len(prefix) == 1 {
+		return ""
+	}
+
+	return string(prefix[1:])
+}
+
+// embeddedCertificate returns the root certificate loaded into IOS by the given main DOL,
+// or nil if it has not been patched to load one.
+func embeddedCertificate(version *ShopVersion, layout *DOL, dol []byte, symbols *SymbolMap) []byte {
+	set, err := LoadCustomCA(nil, symbols, NewAllocator(version.FreeRegions))
+	if err != nil {
+		return nil
+	}
+
+	patch, _ := findPatch(set, "Modify NHTTPi_SocSSLConnect to load cert")
+	offset, ok := embeddedOffset(version, patch, layout, symbols)
+	if !ok || offset+16 > len(dol) {
+		return nil
+	}
+
+	// As patched, we load our certificate's address via lis and ori, and its length via addi.
+	words := dol[offset : offset+16]
+	lis := binary.BigEndian.Uint32(words[0:4])
+	ori := binary.BigEndian.Uint32(words[4:8])
+	addi := binary.BigEndian.Uint32(words[12:16])
+	if lis&0xffff0000 != 0x3c800000 || ori&0xffff0000 != 0x60840000 || addi&0xffff0000 != 0x38a50000 {
+		return nil
+	}
+
+	address := lis<<16 | ori&0xffff
+	length := int(addi & 0xffff)
+	certificate, err := layout.OffsetOf(address)
+	if err != nil || certificate+length > len(dol) {
+		return nil
+	}
+
+	return cloneBytes(dol[certificate : certificate+length])
+}
+
+// findPatch returns the patch with the given name within the given set.
+func findPatch(set DOLPatchSet, name string) (DOLPatch, bool) {
+	for _, patch := range set.Patches {
+		if patch.Name == name {
+			return patch, true
+		}
+	}
+
+	return DOLPatch{}, false
+}
+
+// embeddedOffset returns the offset of the given patch within the given main DOL, regardless of its contents.
+func embeddedOffset(version *ShopVersion, patch DOLPatch, layout *DOL, symbols *SymbolMap) (int, bool) {
+	if offset, ok := version.Offsets[patch.Name]; ok {
+		return offset, true
+	}
+
+	candidates, err := version.candidates(DOLPatchSet{}, patch, layout, symbols)
+	if err != nil || len(candidates) == 0 {
+		return 0, false
+	}
+
+	return candidates[0], true
+}
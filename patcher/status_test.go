@@ -0,0 +1,53 @@
+package patcher
+
+import (
+	"testing"
+)
+
+func TestStatusReflectsRecordedSelection(t *testing.T) {
+	original := testWAD(t, testDOL(t), testARC(t, []byte("[include]\r\n"), []byte{0, 0, 0x10, 0}))
+
+	// Disabling "Clear extraneous functions" omits the space it frees, which overwrite_ios requires if selected.
+	selected := []string{"ec_title_check", "custom_ca", "base_domain"}
+	// "Mark all tickets as managed" is disabled within a selected patch set, and so remains original.
+	disabled := []string{"Clear extraneous functions", "Mark all tickets as managed"}
+	p, err := New(Options{
+		BaseDomain:      "a.taur.cloud",
+		RootCertificate: testCertificate(t),
+		PatchSets:       selected,
+		DisabledPatches: disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, _, err := p.Patch(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Status(patched, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.PatchSets) != len(AvailablePatchSets) {
+		t.Fatalf("reported %d patch sets, whereas %d are available", len(report.PatchSets), len(AvailablePatchSets))
+	}
+
+	for _, set := range report.PatchSets {
+		enabled := false
+		for _, id := range selected {
+			enabled = enabled || set.ID == id
+		}
+
+		for _, patch := range set.Patches {
+			expected := PatchOriginal
+			if enabled && patch.Name != disabled[1] {
+				expected = PatchApplied
+			}
+			if patch.State != expected {
+				t.Errorf("%s: %q is %s, whereas %s was expected", set.ID, patch.Name, patch.State, expected)
+			}
+		}
+	}
+}
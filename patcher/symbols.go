@@ -0,0 +1,348 @@
+package patcher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wii-tools/arclib"
+	"github.com/wii-tools/wadlib"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrEmptySymbolMap = errors.New("the symbol map contains no symbols")
+
+// Symbol describes a named function or object within the main DOL.
+type Symbol struct {
+	// Name is this symbol's name as present within the map, possibly mangled.
+	Name string
+
+	// Demangled is this symbol's qualified name without parameters,
+	// such as "ec::isManagedTicket". It is equal to Name for C symbols.
+	Demangled string
+
+	// Address is the virtual address this symbol begins at.
+	Address uint32
+
+	// Size is the length of this symbol, or zero if unknown.
+	Size uint32
+}
+
+// SymbolMap resolves symbols within the main DOL by name or address.
+// It is not modified after parsing, and may be shared between concurrent patchers.
+type SymbolMap struct {
+	// symbols contains all symbols, sorted by address.
+	symbols []Symbol
+
+	// names maps both mangled and demangled names to their index within symbols.
+	names map[string]int
+}
+
+// ParseSymbolMap parses a CodeWarrior linker map, or a map in the similar format Dolphin exports.
+// Lines consisting solely of an address and name are additionally accepted, permitting maps written by hand.
+func ParseSymbolMap(contents []byte) (*SymbolMap, error) {
+	var symbols []Symbol
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		symbol, ok := parseSymbolLine(scanner.Text())
+		if ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(symbols) == 0 {
+		return nil, ErrEmptySymbolMap
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Address < symbols[j].Address
+	})
+
+	// When names are ambiguous, such as with overloads, the lowest address is preferred.
+	names := map[string]int{}
+	for i, symbol := range symbols {
+		for _, name := range []string{symbol.Name, symbol.Demangled} {
+			if _, present := names[name]; !present {
+				names[name] = i
+			}
+		}
+	}
+
+	return &SymbolMap{symbols, names}, nil
+}
+
+// parseSymbolLine parses a single line within a symbol map, returning false if it does not describe a symbol.
+// Linker maps list symbols as "start size address [offset] alignment name [object]",
+// where the file offset is only present within newer versions of CodeWarrior.
+func parseSymbolLine(line string) (Symbol, bool) {
+	fields := strings.Fields(line)
+
+	if len(fields) == 2 {
+		address, err := parseHex(fields[0])
+		if err != nil || address == 0 {
+			return Symbol{}, false
+		}
+
+		return newSymbol(fields[1], address, 0), true
+	}
+
+	if len(fields) < 5 {
+		return Symbol{}, false
+	}
+
+	// Unused symbols have no address, so are skipped.
+	size, err := parseHex(fields[1])
+	if err != nil {
+		return Symbol{}, false
+	}
+	address, err := parseHex(fields[2])
+	if err != nil || address == 0 {
+		return Symbol{}, false
+	}
+	if _, err = parseHex(fields[0]); err != nil {
+		return Symbol{}, false
+	}
+
+	// File offsets are eight digits, whereas alignment is rarely more than two.
+	nameIndex := 4
+	if len(fields[3]) == 8 {
+		nameIndex = 5
+	}
+	if nameIndex >= len(fields) {
+		return Symbol{}, false
+	}
+	if _, err = strconv.ParseUint(fields[nameIndex-1], 10, 32); err != nil {
+		return Symbol{}, false
+	}
+
+	// Section entries, such as ".text", are not symbols.
+	name := fields[nameIndex]
+	if strings.HasPrefix(name, ".") {
+		return Symbol{}, false
+	}
+
+	return newSymbol(name, address, size), true
+}
+
+// parseHex parses a hexadecimal value with an optional 0x prefix.
+func parseHex(value string) (uint32, error) {
+	value = strings.TrimPrefix(strings.ToLower(value), "0x")
+	parsed, err := strconv.ParseUint(value, 16, 32)
+	return uint32(parsed), err
+}
+
+// newSymbol returns a symbol with the given name, demangling it if possible.
+func newSymbol(name string, address uint32, size uint32) Symbol {
+	return Symbol{
+		Name:      name,
+		Demangled: demangle(name),
+		Address:   address,
+		Size:      size,
+	}
+}
+
+// demangle returns the qualified name of a CodeWarrior-mangled symbol, omitting its parameters.
+// For example, "isManagedTicket__2ecFUx" becomes "ec::isManagedTicket",
+// and "__ct__Q23ipl9ExceptionFv" becomes "ipl::Exception::__ct".
+// Names that are not mangled are returned as-is.
+func demangle(name string) string {
+	// Special names, such as __ct, begin with underscores we must skip.
+	separator := strings.Index(strings.TrimLeft(name, "_"), "__")
+	if separator == -1 {
+		return name
+	}
+	separator += len(name) - len(strings.TrimLeft(name, "_"))
+
+	base := name[:separator]
+	qualifiers, ok := parseQualifiers(name[separator+2:])
+	if !ok {
+		return name
+	}
+
+	return strings.Join(append(qualifiers, base), "::")
+}
+
+// parseQualifiers parses the namespaces and classes following a mangled name's separator.
+// A single qualifier is prefixed by its length, while multiple are prefixed by "Q" and their count.
+func parseQualifiers(mangled string) ([]string, bool) {
+	count := 1
+	if strings.HasPrefix(mangled, "Q") && len(mangled) > 1 {
+		count = int(mangled[1] - '0')
+		mangled = mangled[2:]
+	} else if strings.HasPrefix(mangled, "F") {
+		// Free functions have no qualifiers.
+		return nil, true
+	}
+
+	var qualifiers []string
+	for i := 0; i < count; i++ {
+		digits := 0
+		for digits < len(mangled) && mangled[digits] >= '0' && mangled[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
+			return nil, false
+		}
+
+		length, _ := strconv.Atoi(mangled[:digits])
+		mangled = mangled[digits:]
+		if length > len(mangled) {
+			return nil, false
+		}
+
+		qualifiers = append(qualifiers, mangled[:length])
+		mangled = mangled[length:]
+	}
+
+	return qualifiers, true
+}
+
+// Symbols returns all symbols within this map, sorted by address.
+func (m *SymbolMap) Symbols() []Symbol {
+	if m == nil {
+		return nil
+	}
+
+	return append([]Symbol{}, m.symbols...)
+}
+
+// Lookup returns the symbol with the given mangled or demangled name.
+func (m *SymbolMap) Lookup(name string) (Symbol, bool) {
+	if m == nil {
+		return Symbol{}, false
+	}
+
+	index, ok := m.names[name]
+	if !ok {
+		return Symbol{}, false
+	}
+
+	return m.symbols[index], true
+}
+
+// Resolve returns the address of the given symbol, optionally followed by
+// an offset within it such as "NHTTPi_SocSSLConnect+0x1c".
+func (m *SymbolMap) Resolve(reference string) (uint32, error) {
+	name, offset := reference, uint32(0)
+	if plus := strings.LastIndex(reference, "+"); plus != -1 {
+		parsed, err := parseHex(reference[plus+1:])
+		if err == nil {
+			name, offset = reference[:plus], parsed
+		}
+	}
+
+	symbol, ok := m.Lookup(name)
+	if !ok {
+		return 0, &SymbolError{Symbol: reference}
+	}
+
+	return symbol.Address + offset, nil
+}
+
+// AddressOr returns the address of the given symbol, or the given fallback if it cannot be resolved,
+// such as when no symbol map is available. Fallbacks are addresses within version 21.
+func (m *SymbolMap) AddressOr(reference string, fallback uint32) uint32 {
+	address, err := m.Resolve(reference)
+	if err != nil {
+		return fallback
+	}
+
+	return address
+}
+
+// SymbolAt returns the symbol containing the given address.
+// Symbols of an unknown size only contain their first address.
+func (m *SymbolMap) SymbolAt(address uint32) (Symbol, bool) {
+	if m == nil {
+		return Symbol{}, false
+	}
+
+	// Find the last symbol beginning at or before our address.
+	index := sort.Search(len(m.symbols), func(i int) bool {
+		return m.symbols[i].Address > address
+	}) - 1
+
+	for ; index >= 0; index-- {
+		symbol := m.symbols[index]
+		if symbol.Address == address || address-symbol.Address < symbol.Size {
+			return symbol, true
+		}
+
+		// Earlier symbols may only contain our address if they share this symbol's address.
+		if index > 0 && m.symbols[index-1].Address != symbol.Address {
+			break
+		}
+	}
+
+	return Symbol{}, false
+}
+
+// Label returns a human-readable label for the given address, such as "ec::isManagedTicket+0x10".
+// It returns an empty string if no symbol contains the address.
+func (m *SymbolMap) Label(address uint32) string {
+	symbol, ok := m.SymbolAt(address)
+	if !ok {
+		return ""
+	}
+
+	if symbol.Address == address {
+		return symbol.Demangled
+	}
+
+	return fmt.Sprintf("%s+0x%x", symbol.Demangled, address-symbol.Address)
+}
+
+// FindSymbolMap returns the path and contents of the first symbol map within the given ARC.
+// Any file with the extension ".map" is considered a symbol map.
+func FindSymbolMap(arc *arclib.ARC) (string, []byte, bool) {
+	return findSymbolMap(arc.RootRecord, "")
+}
+
+// findSymbolMap recursively searches the given directory for a symbol map.
+func findSymbolMap(dir arclib.ARCDir, path string) (string, []byte, bool) {
+	for _, file := range dir.Files {
+		if strings.HasSuffix(strings.ToLower(file.Filename), ".map") {
+			return path + file.Filename, file.Data, true
+		}
+	}
+
+	for _, subdir := range dir.Subdirs {
+		found, contents, ok := findSymbolMap(subdir, path+subdir.Filename+"/")
+		if ok {
+			return found, contents, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// LoadSymbols returns the symbol map present within the given WAD's main ARC.
+// It returns nil without an error if the ARC contains no symbol map.
+func LoadSymbols(wad *wadlib.WAD) (*SymbolMap, error) {
+	arcData, err := wad.GetContent(2)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+	arc, err := arclib.Load(arcData)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+
+	path, contents, ok := FindSymbolMap(arc)
+	if !ok {
+		return nil, nil
+	}
+
+	symbols, err := ParseSymbolMap(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s within the main ARC: %w", path, err)
+	}
+
+	return symbols, nil
+}
@@ -0,0 +1,25 @@
+package patcher
+
+import (
+	"testing"
+)
+
+func TestDemangle(t *testing.T) {
+	tests := []struct {
+		mangled   string
+		demangled string
+	}{
+		{"isManagedTicket__2ecFUx", "ec::isManagedTicket"},
+		{"__ct__Q23ipl9ExceptionFv", "ipl::Exception::__ct"},
+		{"NHTTPi_SocSSLConnect__FP13NHTTPConnInfo", "NHTTPi_SocSSLConnect"},
+		{"SSLSetRootCA", "SSLSetRootCA"},
+		{"__ArenaLo", "__ArenaLo"},
+		// Malformed qualifiers are left as-is.
+		{"broken__Q29short", "broken__Q29short"},
+	}
+	for _, test := range tests {
+		if demangled := demangle(test.mangled); demangled != test.demangled {
+			t.Errorf("%s demangled as \"%s\", expected \"%s\"", test.mangled, demangled, test.demangled)
+		}
+	}
+}
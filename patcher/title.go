@@ -0,0 +1,47 @@
+package patcher
+
+import (
+	"errors"
+	"github.com/wii-tools/wadlib"
+)
+
+const (
+	// ShopTitleID is the title ID of the Wii Shop Channel, HABA.
+	ShopTitleID uint64 = 0x00010002_48414241
+
+	// ShopTitleVersion is the latest version of the Wii Shop Channel, downloaded by default.
+	// See SupportedVersions for all versions we are able to patch.
+	ShopTitleVersion uint16 = 21
+)
+
+// wadHeaderSize is the size of the header at the start of every WAD.
+const wadHeaderSize = 0x20
+
+// LoadWAD parses the given WAD, ensuring it is a version of the Wii Shop Channel we are able to patch.
+func LoadWAD(contents []byte) (*wadlib.WAD, error) {
+	// wadlib assumes a header is present.
+	if len(contents) < wadHeaderSize {
+		return nil, &InvalidWADError{errors.New("contents are too small to contain a WAD header")}
+	}
+
+	wad, err := wadlib.LoadWAD(contents)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+
+	err = ValidateTitle(wad)
+	if err != nil {
+		return nil, err
+	}
+
+	return wad, nil
+}
+
+// ValidateTitle ensures the given WAD's TMD describes a version of the Wii Shop Channel we are able to patch.
+func ValidateTitle(wad *wadlib.WAD) error {
+	if wad.TMD.TitleID != ShopTitleID || FindVersion(wad.TMD.TitleVersion) == nil {
+		return &UnsupportedTitleError{wad.TMD.TitleID, wad.TMD.TitleVersion}
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"github.com/wii-tools/powerpc"
+)
+
+// ShopVersion describes a revision of the Wii Shop Channel we are able to patch.
+type ShopVersion struct {
+	// TitleVersion is this revision's version within its TMD.
+	TitleVersion uint16
+
+	// DOLHashes lists the SHA-1 hashes, in hex, of main DOLs known for this revision.
+	// Any other main DOL, such as one already modified, is rejected unless Options.AllowUnknownDOL is set.
+	// If empty, no hash is known, and any main DOL is accepted; patches are then verified against their original bytes alone.
+	DOLHashes []string
+
+	// Offsets maps the names of patches to their file offsets within this revision's main DOL.
+	// If nil, patches are applied at the offsets they are defined with.
+	// Patches located by searching (those without an address) are never relocated.
+	Offsets map[string]int
+
+	// FreeRegions lists space within this revision's main DOL that patches may allocate.
+	FreeRegions []FreeRegion
+}
+
+// SupportedVersions lists all revisions of the Wii Shop Channel we are able to patch.
+var SupportedVersions = []ShopVersion{
+	{
+		// All patches are defined against version 21, so it requires no relocation.
+		// Its main DOL as distributed via NUS has not yet been recorded, so any is accepted.
+		TitleVersion: 21,
+		FreeRegions: []FreeRegion{
+			{
+				// See docs/patch_custom_ca_ios.md for more information.
+				Name:    "unused Shift-JIS conversion table",
+				Address: 0x802e97b8,
+				Size:    MaxCertificateLength,
+			},
+			{
+				Name:    "empty space within data",
+				Address: 0x803126e0,
+				Size:    52,
+			},
+			{
+				// See docs/patch_overwrite_ios.md for more information.
+				Name:       "coalesced textinput::EventObserver methods",
+				Address:    0x800143f4,
+				Size:       108,
+				Executable: true,
+				FreedBy:    "Clear extraneous functions",
+			},
+		},
+	},
+}
+
+// FindVersion returns the supported revision with the given title version, or nil if none exist.
+func FindVersion(titleVersion uint16) *ShopVersion {
+	for i := range SupportedVersions {
+		if SupportedVersions[i].TitleVersion == titleVersion {
+			return &SupportedVersions[i]
+		}
+	}
+
+	return nil
+}
+
+// IdentifyVersion returns the supported revision matching the given title version and main DOL.
+// The main DOL must be one known for its revision, as listed within DOLHashes.
+func IdentifyVersion(titleVersion uint16, dol []byte) (*ShopVersion, error) {
+	version := FindVersion(titleVersion)
+	if version == nil {
+		return nil, &UnsupportedTitleError{ShopTitleID, titleVersion}
+	}
+
+	if err := version.verifyDOL(dol); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// verifyDOL ensures the given main DOL is known for this revision.
+// If no hashes are listed, any main DOL is accepted.
+func (v *ShopVersion) verifyDOL(dol []byte) error {
+	if len(v.DOLHashes) == 0 {
+		return nil
+	}
+
+	hash := fmt.Sprintf("%x", sha1.Sum(dol))
+	for _, known := range v.DOLHashes {
+		if known == hash {
+			return nil
+		}
+	}
+
+	return &UnknownDOLError{v.TitleVersion, hash}
+}
+
+// Relocate returns the given patch sets with file offsets determined for this revision's main DOL.
+// A patch declaring its own offset is applied there. Otherwise, it is located via its offset within our table,
+// if present, and then via its symbol or, for the revision patches are defined against, its address.
+// If their original bytes are not present there, they are located via their signature.
+// The given symbol map may be nil.
+func (v *ShopVersion) Relocate(sets []DOLPatchSet, dol []byte, symbols *SymbolMap) ([]powerpc.PatchSet, error) {
+	layout, err := ParseDOL(dol)
+	if err != nil {
+		return nil, &InvalidWADError{err}
+	}
+
+	var relocated []powerpc.PatchSet
+	for _, set := range sets {
+		resolved := powerpc.PatchSet{
+			Name: set.Name,
+		}
+
+		for _, patch := range set.Patches {
+			// Patches without an address are located by searching for their original bytes.
+			offset := patch.AtOffset
+			if offset == 0 && (patch.AtAddress != 0 || patch.AtSymbol != "" || patch.Signature != nil) {
+				offset, err = v.locate(set, patch, layout, dol, symbols)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			resolved.Patches = append(resolved.Patches, powerpc.Patch{
+				Name:     patch.Name,
+				AtOffset: offset,
+				Before:   patch.Before,
+				After:    patch.After,
+			})
+		}
+
+		relocated = append(relocated, resolved)
+	}
+
+	return relocated, nil
+}
+
+// locate returns the offset of the given patch within this revision's main DOL.
+func (v *ShopVersion) locate(set DOLPatchSet, patch DOLPatch, layout *DOL, dol []byte, symbols *SymbolMap) (int, error) {
+	if offset, ok := v.Offsets[patch.Name]; ok {
+		return offset, nil
+	}
+
+	candidates, candidateErr := v.candidates(set, patch, layout, symbols)
+	for _, offset := range candidates {
+		if offset <= len(dol) && bytes.HasPrefix(dol[offset:], patch.Before) {
+			return offset, nil
+		}
+	}
+
+	signature, ok := patch.signature()
+	if !ok {
+		if candidateErr != nil {
+			return 0, candidateErr
+		}
+
+		// Some patches rely on earlier ones, and cannot be verified until applied.
+		return candidates[0], nil
+	}
+
+	offset, err := signature.Locate(dol)
+	var signatureErr *SignatureError
+	if errors.As(err, &signatureErr) {
+		return 0, &SignatureError{set.Name, patch.Name, signatureErr.Matches}
+	}
+
+	return offset, err
+}
+
+// candidates returns the offsets the given patch is declared at for this revision, in order of preference:
+// that of its symbol, and then for the revision patches are defined against, that of its address.
+// Its original bytes are not verified. If no offsets are available, an error describing why is returned.
+func (v *ShopVersion) candidates(set DOLPatchSet, patch DOLPatch, layout *DOL, symbols *SymbolMap) ([]int, error) {
+	var addresses []uint32
+	if address, err := symbols.Resolve(patch.AtSymbol); patch.AtSymbol != "" && err == nil {
+		addresses = append(addresses, address)
+	}
+
+	// Addresses are only meaningful for the revision patches are defined against.
+	if patch.AtAddress != 0 && v.Offsets == nil {
+		addresses = append(addresses, patch.AtAddress)
+	}
+
+	if len(addresses) == 0 {
+		if patch.AtAddress == 0 {
+			return nil, &SymbolError{set.Name, patch.Name, patch.AtSymbol}
+		}
+
+		return nil, &UnsupportedPatchError{v.TitleVersion, set.Name, patch.Name}
+	}
+
+	var offsets []int
+	var addressErr error
+	for _, address := range addresses {
+		offset, err := layout.OffsetOf(address)
+		if err != nil {
+			addressErr = &AddressError{set.Name, patch.Name, address}
+			continue
+		}
+
+		offsets = append(offsets, offset)
+	}
+
+	if len(offsets) == 0 {
+		return nil, addressErr
+	}
+
+	return offsets, nil
+}
+
+// supportedVersionList returns all supported title versions, for usage within errors.
+func supportedVersionList() string {
+	list := ""
+	for i, version := range SupportedVersions {
+		if i != 0 {
+			list += ", "
+		}
+
+		list += fmt.Sprint(version.TitleVersion)
+	}
+
+	return list
+}
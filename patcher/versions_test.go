@@ -0,0 +1,27 @@
+package patcher
+
+import (
+	"testing"
+)
+
+func TestIdentifyVersion(t *testing.T) {
+	dol := testDOL(t)
+
+	// No hash is recorded for version 21, so its main DOL is accepted regardless.
+	version, err := IdentifyVersion(21, dol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.TitleVersion != 21 {
+		t.Fatalf("identified version %d, rather than 21", version.TitleVersion)
+	}
+
+	if _, err := IdentifyVersion(20, dol); err == nil {
+		t.Fatal("an unsupported version was identified")
+	}
+
+	known := ShopVersion{TitleVersion: 21, DOLHashes: []string{"0000000000000000000000000000000000000000"}}
+	if _, ok := known.verifyDOL(dol).(*UnknownDOLError); !ok {
+		t.Fatal("a main DOL not listed within DOLHashes was accepted")
+	}
+}
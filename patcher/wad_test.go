@@ -0,0 +1,163 @@
+package patcher
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"github.com/wii-tools/arclib"
+	"github.com/wii-tools/wadlib"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testDOLSize is the length of the main DOL within our synthetic WAD.
+const testDOLSize = 0x340000
+
+// testDOL returns a synthetic main DOL with the layout of version 21,
+// containing the original bytes of every available patch where it applies.
+func testDOL(t *testing.T) []byte {
+	t.Helper()
+
+	dol := make([]byte, testDOLSize)
+	put := func(offset int, value uint32) { binary.BigEndian.PutUint32(dol[offset:], value) }
+	// text0, text1 and data0, followed by the BSS and entry point.
+	put(0x00, 0x100)
+	put(0x48, 0x80004000)
+	put(0x90, 0x2500)
+	put(0x04, 0x2600)
+	put(0x4c, 0x80011ac0)
+	put(0x94, 0x200000-0x2600)
+	put(0x1c, 0x210000)
+	put(0x64, 0x80213f00)
+	put(0xac, 0x130000)
+	put(0xd8, 0x80400000)
+	put(0xdc, 0x10000)
+	put(0xe0, 0x80004000)
+
+	layout, err := ParseDOL(dol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Patcher{Options{BaseDomain: NintendoBaseDomain, RootCertificate: testCertificate(t)}}
+	space := NewAllocator(p.freeRegions(FindVersion(21)))
+	for _, named := range AvailablePatchSets {
+		set, err := named.Set(p.options, space)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, patch := range set.Patches {
+			// Patches placed within free space apply over null bytes, some of which other patches must clear.
+			if patch.AtAddress == 0 || bytes.Count(patch.Before, []byte{0}) == len(patch.Before) {
+				continue
+			}
+
+			offset, err := layout.OffsetOf(patch.AtAddress)
+			if err != nil {
+				t.Fatalf("patch \"%s\": %v", patch.Name, err)
+			}
+			copy(dol[offset:], patch.Before)
+		}
+	}
+
+	// Load __ArenaLo as OSInit would, following the BSS and stacks.
+	osInit, _ := layout.OffsetOf(0x80100000)
+	copy(dol[osInit:], MustAssemble("lis r3, 0x8042\naddi r3, r3, 0x2000", 0x80100000, nil))
+
+	// Strings our base domain patches search for.
+	copy(dol[0x250000:], ShowManualURL)
+	copy(dol[0x251000:], ShowManualURL)
+	copy(dol[0x252000:], "https://oss-auth"+TrustedDomain+"\x00")
+	return dol
+}
+
+// testARC returns a synthetic main ARC containing the given Opera files.
+func testARC(t *testing.T, filter []byte, certStore []byte) []byte {
+	t.Helper()
+
+	arc := arclib.ARC{RootRecord: arclib.ARCDir{Subdirs: []arclib.ARCDir{{
+		Filename: "arc",
+		Subdirs: []arclib.ARCDir{{
+			Filename: "opera",
+			Files: []arclib.ARCFile{
+				{Filename: "myfilter.ini", Data: filter},
+				{Filename: "opcacrt6.dat", Data: certStore},
+			},
+		}},
+	}}}}
+
+	contents, err := arc.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contents
+}
+
+// testWAD returns a synthetic Wii Shop Channel WAD of version 21 with the given main DOL and ARC.
+func testWAD(t *testing.T, dol []byte, arc []byte) []byte {
+	t.Helper()
+
+	var wad wadlib.WAD
+	if err := wad.LoadTMD(wadlib.TMDTemplate); err != nil {
+		t.Fatal(err)
+	}
+	if err := wad.LoadTicket(wadlib.TicketTemplate); err != nil {
+		t.Fatal(err)
+	}
+	wad.CertificateChain = wadlib.CertChainTemplate
+	wad.TMD.TitleID = ShopTitleID
+	wad.Ticket.TitleID = ShopTitleID
+	wad.TMD.TitleVersion = 21
+	wad.TMD.AccessRightsFlags = 0x1
+
+	contents := [][]byte{[]byte("banner"), dol, arc}
+	wad.TMD.NumberOfContents = uint16(len(contents))
+	wad.TMD.Contents = make([]wadlib.ContentRecord, len(contents))
+	wad.Data = make([]wadlib.WADFile, len(contents))
+	for i := range contents {
+		wad.TMD.Contents[i] = wadlib.ContentRecord{ID: uint32(i), Index: uint16(i), Type: wadlib.TitleTypeNormal}
+		wad.Data[i] = wadlib.WADFile{Record: &wad.TMD.Contents[i]}
+		if err := wad.UpdateContent(i, contents[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serialized, err := wad.GetWAD(wadlib.WADTypeCommon)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return serialized
+}
+
+// testCertificate returns a self-signed certificate small enough to be loaded as our root certificate.
+func testCertificate(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "WSC-Patcher Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
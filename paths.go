@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"os"
+	"path/filepath"
+)
+
+// PathsProfile describes where all inputs and outputs are located.
+// Relative paths are resolved against WorkDir, permitting
+// multiple builds to run side-by-side within separate directories.
+type PathsProfile struct {
+	// WorkDir is the directory all other relative paths are resolved against.
+	WorkDir string `yaml:"work_dir"`
+
+	// CacheDir is the directory the original WAD is cached within.
+	CacheDir string `yaml:"cache_dir"`
+
+	// OutputDir is the directory certificates and the patched WAD are written to.
+	OutputDir string `yaml:"output_dir"`
+
+	// OriginalWAD is the path of the cached original WAD.
+	// If empty, original.wad within CacheDir is used - or, for versions
+	// other than the latest, original-v<version>.wad.
+	OriginalWAD string `yaml:"original_wad"`
+
+	// InputWAD is the path of a WAD to patch in place of our cached original, such as one's own dump.
+	// It is never downloaded, and "-" reads it from standard input.
+	InputWAD string `yaml:"input_wad"`
+
+	// SymbolMap is the path of a symbol map for the main DOL, such as a CodeWarrior linker map.
+	// If empty, the symbol map within the main ARC is used, if present.
+	SymbolMap string `yaml:"symbol_map"`
+
+	// PatchedWAD is the path our patched WAD is written to.
+	// If empty, patched.wad within OutputDir is used.
+	PatchedWAD string `yaml:"patched_wad"`
+
+	// Report is the path a JSON build report is written to.
+	// If empty, no report is written.
+	Report string `yaml:"report"`
+
+	// Delta is the path a distributable delta from the original to the patched WAD is written to.
+	// If empty, no delta is written.
+	Delta string `yaml:"delta"`
+}
+
+// stdinPath is the path representing standard input.
+const stdinPath = "-"
+
+// defaultPaths returns paths relative to the current directory,
+// as WSC-Patcher has historically used.
+func defaultPaths() PathsProfile {
+	return PathsProfile{
+		WorkDir:   ".",
+		CacheDir:  "cache",
+		OutputDir: "output",
+	}
+}
+
+// resolvePath resolves the given path against the profile's working directory.
+func (p Profile) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(p.Paths.WorkDir, path)
+}
+
+// cachePath returns the path of a file with the given name within our cache directory.
+func (p Profile) cachePath(filename string) string {
+	return filepath.Join(p.resolvePath(p.Paths.CacheDir), filename)
+}
+
+// outputPath returns the path of a file with the given name within our output directory.
+func (p Profile) outputPath(filename string) string {
+	return filepath.Join(p.resolvePath(p.Paths.OutputDir), filename)
+}
+
+// originalWADPath returns the path of our cached original WAD.
+func (p Profile) originalWADPath() string {
+	if p.Paths.OriginalWAD != "" {
+		return p.resolvePath(p.Paths.OriginalWAD)
+	}
+
+	if p.TitleVersion != patcher.ShopTitleVersion {
+		return p.cachePath(fmt.Sprintf("original-v%d.wad", p.TitleVersion))
+	}
+
+	return p.cachePath("original.wad")
+}
+
+// inputWADPath returns the path of the WAD to patch: the input WAD if specified,
+// or otherwise our cached original WAD. "-" represents standard input.
+func (p Profile) inputWADPath() string {
+	if p.Paths.InputWAD == stdinPath {
+		return stdinPath
+	}
+
+	if p.Paths.InputWAD != "" {
+		return p.resolvePath(p.Paths.InputWAD)
+	}
+
+	return p.originalWADPath()
+}
+
+// patchedWADPath returns the path our patched WAD is written to.
+func (p Profile) patchedWADPath() string {
+	if p.Paths.PatchedWAD != "" {
+		return p.resolvePath(p.Paths.PatchedWAD)
+	}
+
+	return p.outputPath("patched.wad")
+}
+
+// reportPath returns the path our build report is written to, or an empty string if none should be.
+func (p Profile) reportPath() string {
+	if p.Paths.Report == "" {
+		return ""
+	}
+
+	return p.resolvePath(p.Paths.Report)
+}
+
+// deltaPath returns the path our delta is written to, or an empty string if none should be.
+func (p Profile) deltaPath() string {
+	if p.Paths.Delta == "" {
+		return ""
+	}
+
+	return p.resolvePath(p.Paths.Delta)
+}
+
+// symbolMapPath returns the path of our symbol map, or an empty string if that within the main ARC should be used.
+func (p Profile) symbolMapPath() string {
+	if p.Paths.SymbolMap == "" {
+		return ""
+	}
+
+	return p.resolvePath(p.Paths.SymbolMap)
+}
+
+// rootCertificatePath returns the path of our root certificate, in DER form.
+func (p Profile) rootCertificatePath() string {
+	if p.Certificates.Root != "" {
+		return p.resolvePath(p.Certificates.Root)
+	}
+
+	return p.outputPath("root.cer")
+}
+
+// writeFile writes the given contents to the given path,
+// creating its parent directory if necessary.
+func writeFile(path string, contents []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return &IOError{path, err}
+	}
+
+	err = os.WriteFile(path, contents, 0755)
+	if err != nil {
+		return &IOError{path, err}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+)
+
+// Profile describes everything needed to reproduce a patched WAD.
+// It can be loaded from a YAML file via loadProfile.
+type Profile struct {
+	// BaseDomain is the domain to replace shop.wii.com with.
+	BaseDomain string `yaml:"base_domain"`
+
+	// TitleVersion is the version of the Wii Shop Channel to download and patch.
+	// See patcher.SupportedVersions for all versions.
+	TitleVersion uint16 `yaml:"title_version"`
+
+	// AllowUnknownDOL permits main DOLs whose hash is not known for their revision, such as those already modified.
+	AllowUnknownDOL bool `yaml:"allow_unknown_dol"`
+
+	// PatchSets lists the identifiers of patch sets to apply, in order.
+	// See patcher.AvailablePatchSets for all identifiers.
+	PatchSets []string `yaml:"patch_sets"`
+
+	// DisabledPatches lists the names of individual patches to skip
+	// within the patch sets above.
+	DisabledPatches []string `yaml:"disabled_patches"`
+
+	// PatchFiles lists paths to YAML or JSON files each defining an additional patch set.
+	// They are applied after those within PatchSets, unless listed within it.
+	PatchFiles []string `yaml:"patch_files"`
+
+	// Certificates describes where our root certificate is sourced.
+	Certificates CertificateProfile `yaml:"certificates"`
+
+	// Filter describes entries within Opera's myfilter.ini.
+	// Both file:/cnt/* and our base domain are always permitted.
+	Filter patcher.Filter `yaml:"filter"`
+
+	// TMD describes changes made to the title metadata.
+	TMD TMDProfile `yaml:"tmd"`
+
+	// Sections describes new sections appended to the main DOL for patch payloads.
+	Sections patcher.Sections `yaml:"sections"`
+
+	// Paths describes where all inputs and outputs are located.
+	Paths PathsProfile `yaml:"paths"`
+}
+
+// CertificateProfile describes the source of our root certificate.
+type CertificateProfile struct {
+	// Root is the path to a root certificate in DER form.
+	// If empty, root.cer within our output directory is used.
+	// If not present on disk, certificates are issued and written to our output directory.
+	Root string `yaml:"root"`
+
+	// Regenerate issues new certificates, even if Root is present.
+	Regenerate bool `yaml:"regenerate"`
+}
+
+// TMDProfile describes modifications made to the title metadata.
+type TMDProfile struct {
+	// AccessRights is the value of the TMD's access rights flags.
+	// If not specified, it is set to 0x3 when OverwriteIOSPatch is applied,
+	// permitting r/w access to MEM2_PROT. Otherwise, it is left as-is.
+	AccessRights *uint32 `yaml:"access_rights"`
+}
+
+// defaultProfile returns a profile with our default behavior.
+func defaultProfile() Profile {
+	return Profile{
+		TitleVersion: patcher.ShopTitleVersion,
+		PatchSets:    patcher.DefaultPatchSets(),
+		Filter:       patcher.DefaultFilter(),
+		Paths:        defaultPaths(),
+	}
+}
+
+// loadProfile loads the profile at the given path.
+// Values not specified within the file retain their default.
+func loadProfile(path string) (Profile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Profile{}, &ProfileError{path, err}
+	}
+
+	loaded := defaultProfile()
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&loaded); err != nil {
+		return Profile{}, &ProfileError{path, err}
+	}
+
+	if err = loaded.validate(); err != nil {
+		return Profile{}, &ProfileError{path, err}
+	}
+
+	return loaded, nil
+}
+
+// validate ensures our title version is supported, our patch files are valid, and all patch sets
+// and patches referenced exist, so that we fail prior to patching.
+func (p Profile) validate() error {
+	if patcher.FindVersion(p.TitleVersion) == nil {
+		return &patcher.UnsupportedTitleError{TitleID: patcher.ShopTitleID, TitleVersion: p.TitleVersion}
+	}
+
+	definitions, err := loadPatchSetDefinitions(p)
+	if err != nil {
+		return err
+	}
+
+	return patcher.ValidateSelection(p.PatchSets, p.DisabledPatches, definitions)
+}
+
+// patchSets returns the identifiers of patch sets to apply, followed by those
+// defined within the given patch files that are not already selected.
+func (p Profile) patchSets(definitions []patcher.PatchSetDefinition) []string {
+	selected := append([]string{}, p.PatchSets...)
+	for _, definition := range definitions {
+		present := false
+		for _, id := range selected {
+			present = present || id == definition.ID
+		}
+
+		if !present {
+			selected = append(selected, definition.ID)
+		}
+	}
+
+	return selected
+}
+
+// options returns patcher options reflecting this profile,
+// alongside the given root and (optional) server certificates in DER form.
+// Our symbol map and patch files, if specified, are loaded.
+func (p Profile) options(rootCertificate []byte, serverCertificate []byte) (patcher.Options, error) {
+	symbols, err := loadSymbolMap(p)
+	if err != nil {
+		return patcher.Options{}, err
+	}
+
+	definitions, err := loadPatchSetDefinitions(p)
+	if err != nil {
+		return patcher.Options{}, err
+	}
+
+	return patcher.Options{
+		BaseDomain:          p.BaseDomain,
+		RootCertificate:     rootCertificate,
+		ServerCertificate:   serverCertificate,
+		PatchSets:           p.patchSets(definitions),
+		DisabledPatches:     p.DisabledPatches,
+		PatchSetDefinitions: definitions,
+		Filter:              p.Filter,
+		AccessRights:        p.TMD.AccessRights,
+		Sections:            p.Sections,
+		AllowUnknownDOL:     p.AllowUnknownDOL,
+		Symbols:             symbols,
+	}, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/OpenShopChannel/WSC-Patcher/patcher"
+	"io/ioutil"
+)
+
+// loadServerCertificate loads the server certificate issued within the profile's output directory, in DER form.
+// If none is present, nil is returned.
+func loadServerCertificate(profile Profile) ([]byte, error) {
+	if !filePresent(profile.outputPath("server.pem")) {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadFile(profile.outputPath("server.pem"))
+	if err != nil {
+		return nil, &IOError{profile.outputPath("server.pem"), err}
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", profile.outputPath("server.pem"))
+	}
+
+	return block.Bytes, nil
+}
+
+// writeReport writes the given report as JSON to the given path.
+func writeReport(path string, report *patcher.BuildReport) error {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, contents)
+}